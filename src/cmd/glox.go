@@ -9,17 +9,31 @@ import (
 )
 
 func main() {
-	args := os.Args[1:];
-	if len(args) > 1 {
-		panic("Usage: glox [args]");
+	args := os.Args[1:]
+
+	// assertions are checked unless turned off, e.g. for production runs
+	assertions := true
+	if len(args) > 0 && args[0] == "--no-assert" {
+		assertions = false
+		args = args[1:]
+	}
+
+	if len(args) == 2 && args[0] == "check" {
+		repl.CheckFile(readFile(args[1]))
+	} else if len(args) > 1 {
+		panic("Usage: glox [--no-assert] [check] [script]")
 	} else if len(args) == 1 {
-		cwd, _ := os.Getwd();
-		content, err := os.ReadFile(filepath.Join(cwd, args[0]));
-		if err != nil {
-			panic(fmt.Sprintf("Invalid path '%s', ensure path is relative to current working directory.", args[0]));
-		}
-		repl.RunFile(string(content));
+		repl.RunFile(readFile(args[0]), assertions)
 	} else {
-		repl.RunPrompt();
+		repl.RunPrompt(assertions)
+	}
+}
+
+func readFile(path string) string {
+	cwd, _ := os.Getwd()
+	content, err := os.ReadFile(filepath.Join(cwd, path))
+	if err != nil {
+		panic(fmt.Sprintf("Invalid path '%s', ensure path is relative to current working directory.", path))
 	}
+	return string(content)
 }
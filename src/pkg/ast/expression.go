@@ -18,17 +18,23 @@ type ExpressionVisitor interface {
 	VisitVariableExpression(*VariableExpression) any
 	VisitAssignmentExpression(*AssignmentExpression) any
 	VisitCallExpression(*CallExpression) any
+	VisitPipelineExpression(*PipelineExpression) any
 	VisitLambdaExpression(*LambdaExpression) any
 	VisitSequenceExpression(*SequenceExpression) any
 	VisitArrayExpression(*ArrayExpression) any
 	VisitMapExpression(*MapExpression) any
+	VisitComprehensionExpression(*ComprehensionExpression) any
 	VisitIndexExpression(*IndexExpression) any
+	VisitRangeExpression(*RangeExpression) any
 	VisitIndexedAssignmentExpression(*IndexedAssignmentExpression) any
 	VisitGetExpression(*GetExpression) any
 	VisitSetExpression(*SetExpression) any
 	VisitThisExpression(*ThisExpression) any
 	VisitSuperGetExpression(*SuperGetExpression) any
 	VisitSuperSetExpression(*SuperSetExpression) any
+	VisitClassExpression(*ClassExpression) any
+	VisitObjectExpression(*ObjectExpression) any
+	VisitSpreadExpression(*SpreadExpression) any
 }
 
 type BinaryExpression struct {
@@ -119,6 +125,19 @@ func (e *CallExpression) Accept(v ExpressionVisitor) any {
 	return v.VisitCallExpression(e)
 }
 
+// PipelineExpression calls Callee with Arguments, where nil arguments are
+// the positions that receive the value of Left
+type PipelineExpression struct {
+	Left      Expression
+	Callee    Expression
+	Arguments []Expression
+	Operator  *token.Token
+}
+
+func (e *PipelineExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitPipelineExpression(e)
+}
+
 type LambdaExpression struct {
 	Operator *token.Token
 	Function *FunctionStatement
@@ -154,10 +173,41 @@ func (e *MapExpression) Accept(v ExpressionVisitor) any {
 	return v.VisitMapExpression(e)
 }
 
+// ComprehensionClause is either a `for VARIABLE of ITERABLE` clause or an `if CONDITION` clause
+type ComprehensionClause struct {
+	Variable  *token.Token
+	Iterable  Expression
+	Condition Expression
+}
+
+// ComprehensionExpression builds an array, or a map if Key is not nil
+type ComprehensionExpression struct {
+	Opening *token.Token
+	Key     Expression
+	Value   Expression
+	Clauses []*ComprehensionClause
+}
+
+func (e *ComprehensionExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitComprehensionExpression(e)
+}
+
+type RangeExpression struct {
+	Start, End, Step Expression
+	Inclusive        bool
+	Operator         *token.Token
+}
+
+func (e *RangeExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitRangeExpression(e)
+}
+
 type IndexExpression struct {
 	Object         Expression
 	LeftIndex      Expression
 	RightIndex     Expression
+	Step           Expression
+	Slice          bool
 	ClosingBracket *token.Token
 }
 
@@ -207,3 +257,37 @@ type SuperSetExpression struct {
 func (e *SuperSetExpression) Accept(v ExpressionVisitor) any {
 	return v.VisitSuperSetExpression(e)
 }
+
+// ClassExpression is an anonymous class, e.g. `class < Base { ... }`
+type ClassExpression struct {
+	Keyword *token.Token
+	Class   *ClassStatement
+}
+
+func (e *ClassExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitClassExpression(e)
+}
+
+// ObjectExpression is an object literal, e.g. `object { name: "x", greet() { ... } }`,
+// which creates an instance of a class of its own with the given fields and methods
+type ObjectExpression struct {
+	Keyword *token.Token
+	Fields  []*token.Token
+	Values  []Expression
+	Class   *ClassStatement
+}
+
+func (e *ObjectExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitObjectExpression(e)
+}
+
+// SpreadExpression is `...value` in an array or map literal, which inserts every
+// element of the value in its place. In a map literal it is a key without a value.
+type SpreadExpression struct {
+	Operator *token.Token
+	Expr     Expression
+}
+
+func (e *SpreadExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitSpreadExpression(e)
+}
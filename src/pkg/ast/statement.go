@@ -20,6 +20,8 @@ type StatementVisitor interface {
 	VisitBreakStatement(*BreakStatement)
 	VisitContinueStatement(*ContinueStatement)
 	VisitClassStatement(*ClassStatement)
+	VisitDeferStatement(*DeferStatement)
+	VisitAssertStatement(*AssertStatement)
 }
 
 type ExpressionStatement struct {
@@ -33,6 +35,8 @@ func (s *ExpressionStatement) Accept(v StatementVisitor) {
 type VarStatement struct {
 	Name        *token.Token
 	Initializer Expression
+	Doc         string
+	Type        *TypeAnnotation
 }
 
 func (s *VarStatement) Accept(v StatementVisitor) {
@@ -60,6 +64,11 @@ type LoopStatement struct {
 	Condition Expression
 	Body      Statement
 	Increment Expression
+	Label     *token.Token
+
+	// PerIteration is set for for loops that declare variables in their initializer,
+	// which are copied for each iteration so closures capture that iteration's values
+	PerIteration bool
 }
 
 func (s *LoopStatement) Accept(v StatementVisitor) {
@@ -70,6 +79,7 @@ type ForEachStatement struct {
 	VariableName *token.Token
 	Array        Expression
 	Body         Statement
+	Label        *token.Token
 }
 
 func (s *ForEachStatement) Accept(v StatementVisitor) {
@@ -87,10 +97,18 @@ const (
 )
 
 type FunctionStatement struct {
-	Name   *token.Token
-	Params []*token.Token
-	Body   []Statement
-	Kind   MethodType
+	Name       *token.Token
+	Params     []*token.Token
+	Body       []Statement
+	Kind       MethodType
+	Doc        string
+	ParamTypes []*TypeAnnotation
+	ReturnType *TypeAnnotation
+	Decorators []Expression
+
+	// Requires and Ensures are checked before the body runs and after it returns
+	Requires []*AssertStatement
+	Ensures  []*AssertStatement
 }
 
 func (s *FunctionStatement) Accept(v StatementVisitor) {
@@ -100,14 +118,44 @@ func (s *FunctionStatement) Accept(v StatementVisitor) {
 type ReturnStatement struct {
 	Keyword *token.Token
 	Value   Expression
+
+	// TailCall is set by the resolver when the value is a call that can replace the current call
+	TailCall bool
 }
 
 func (s *ReturnStatement) Accept(v StatementVisitor) {
 	v.VisitReturnStatement(s)
 }
 
+// DeferStatement delays a call until the enclosing block or function exits. The callee
+// and arguments are evaluated when the statement is executed.
+type DeferStatement struct {
+	Keyword *token.Token
+	Call    *CallExpression
+}
+
+func (s *DeferStatement) Accept(v StatementVisitor) {
+	v.VisitDeferStatement(s)
+}
+
+// AssertStatement fails with a runtime error if its condition is false. It is also used for
+// the requires and ensures clauses of functions, which is given by the keyword.
+type AssertStatement struct {
+	Keyword   *token.Token
+	Condition Expression
+	Message   Expression
+
+	// Source is the text of the condition, which is shown when it fails
+	Source string
+}
+
+func (s *AssertStatement) Accept(v StatementVisitor) {
+	v.VisitAssertStatement(s)
+}
+
 type BreakStatement struct {
 	Keyword *token.Token
+	Label   *token.Token
 }
 
 func (s *BreakStatement) Accept(v StatementVisitor) {
@@ -116,6 +164,7 @@ func (s *BreakStatement) Accept(v StatementVisitor) {
 
 type ContinueStatement struct {
 	Keyword *token.Token
+	Label   *token.Token
 }
 
 func (s *ContinueStatement) Accept(v StatementVisitor) {
@@ -126,6 +175,12 @@ type ClassStatement struct {
 	Name       *token.Token
 	Methods    []*FunctionStatement
 	Superclass *VariableExpression
+	Doc        string
+	Fields     []*FieldDeclaration
+	Decorators []Expression
+
+	// Record is set for records, whose Fields are the parameters of their constructor
+	Record bool
 }
 
 func (s *ClassStatement) Accept(v StatementVisitor) {
@@ -0,0 +1,17 @@
+package ast
+
+import "github.com/hutcho66/glox/src/pkg/token"
+
+// TypeAnnotation is an optional static type written in the source, for example
+// `number`, `array<string>` or `Foo?`. Annotations are only used by the type checker
+// and have no effect at runtime.
+type TypeAnnotation struct {
+	Name      *token.Token
+	Arguments []*TypeAnnotation
+	Nullable  bool
+}
+
+type FieldDeclaration struct {
+	Name *token.Token
+	Type *TypeAnnotation
+}
@@ -0,0 +1,843 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/hutcho66/glox/src/pkg/ast"
+	"github.com/hutcho66/glox/src/pkg/lox_error"
+	"github.com/hutcho66/glox/src/pkg/token"
+)
+
+// Checker performs gradual type checking over a resolved program. Only values whose
+// types are known from annotations (or can be inferred from literals and operators)
+// are checked, any other value has type any and is compatible with everything.
+type Checker struct {
+	errors     *lox_error.LoxErrors
+	scopes     []map[string]variable
+	classes    map[*ast.ClassStatement]*classType
+	returnType Type
+	thisType   Type
+}
+
+// variable records the type of a variable's current value, as well as the type it was declared with,
+// which restricts what can be assigned to it. Only annotated variables have a declared type.
+type variable struct {
+	value, declared Type
+}
+
+func NewChecker(errors *lox_error.LoxErrors) *Checker {
+	return &Checker{
+		errors:     errors,
+		scopes:     []map[string]variable{{}},
+		classes:    map[*ast.ClassStatement]*classType{},
+		returnType: nil,
+		thisType:   anyType,
+	}
+}
+
+func (c *Checker) Check(statements []ast.Statement) bool {
+	c.checkStatements(statements)
+	return !c.errors.HadTypeError()
+}
+
+func (c *Checker) checkStatements(statements []ast.Statement) {
+	// classes are declared up front so they can be used in annotations before their declaration
+	c.declareClasses(statements)
+
+	for _, s := range statements {
+		c.checkStatement(s)
+	}
+}
+
+func (c *Checker) checkStatement(statement ast.Statement) {
+	statement.Accept(c)
+}
+
+func (c *Checker) checkExpression(expression ast.Expression) Type {
+	if t, ok := expression.Accept(c).(Type); ok {
+		return t
+	}
+	return anyType
+}
+
+func (c *Checker) checkFunction(function *ast.FunctionStatement, signature *signatureType) {
+	enclosingReturnType := c.returnType
+	c.returnType = nil
+	if function.ReturnType != nil {
+		c.returnType = signature.returnType
+	}
+
+	c.beginScope()
+	for i, param := range function.Params {
+		c.define(param, signature.params[i])
+	}
+
+	for _, condition := range function.Requires {
+		c.checkStatement(condition)
+	}
+	if len(function.Ensures) > 0 {
+		var result Type = anyType
+		if c.returnType != nil {
+			result = c.returnType
+		}
+
+		c.beginScope()
+		c.define(&token.Token{Type: token.IDENTIFIER, Lexeme: "result", Line: function.Ensures[0].Keyword.Line}, result)
+		for _, condition := range function.Ensures {
+			c.checkStatement(condition)
+		}
+		c.endScope()
+	}
+
+	c.checkStatements(function.Body)
+	c.endScope()
+
+	c.returnType = enclosingReturnType
+}
+
+func (c *Checker) declareClasses(statements []ast.Statement) {
+	declared := []*ast.ClassStatement{}
+	for _, s := range statements {
+		if class, ok := s.(*ast.ClassStatement); ok {
+			classType := newClassType(class.Name.Lexeme)
+			c.classes[class] = classType
+			c.defineClass(class, classType)
+			declared = append(declared, class)
+		}
+	}
+
+	// members are defined once all classes are declared, as they can refer to each other
+	for _, class := range declared {
+		c.defineMembers(class, c.classes[class])
+	}
+}
+
+// defineClass defines the name of a class, a decorated class could be replaced by anything
+func (c *Checker) defineClass(s *ast.ClassStatement, class *classType) {
+	if len(s.Decorators) > 0 {
+		c.defineInferred(s.Name, anyType)
+	} else {
+		c.defineInferred(s.Name, class)
+	}
+}
+
+func (c *Checker) defineMembers(s *ast.ClassStatement, class *classType) {
+	if s.Superclass != nil {
+		if super, ok := c.lookup(s.Superclass.Name).(*classType); ok {
+			class.super = super
+		}
+	}
+
+	for _, field := range s.Fields {
+		class.fields[field.Name.Lexeme] = c.annotationType(field.Type)
+	}
+
+	if s.Record {
+		// records are constructed from their fields, and copied with changes by with
+		class.record = true
+		params := make([]Type, len(s.Fields))
+		for i, field := range s.Fields {
+			params[i] = class.fields[field.Name.Lexeme]
+		}
+		class.methods["init"] = &signatureType{params: params, returnType: nilType}
+		class.methods["with"] = &signatureType{params: []Type{&mapType{value: anyType}}, returnType: &instanceType{class: class}}
+	}
+
+	for _, method := range s.Methods {
+		if len(method.Decorators) > 0 {
+			// the decorator determines the type of the method
+			continue
+		}
+
+		signature := c.signature(method)
+		switch method.Kind {
+		case ast.GETTER_METHOD:
+			class.getters[method.Name.Lexeme] = signature.returnType
+		case ast.SETTER_METHOD:
+			class.setters[method.Name.Lexeme] = signature.params[0]
+		default:
+			class.methods[method.Name.Lexeme] = signature
+		}
+	}
+}
+
+func (c *Checker) signature(function *ast.FunctionStatement) *signatureType {
+	params := make([]Type, len(function.Params))
+	for i := range function.Params {
+		params[i] = anyType
+		if i < len(function.ParamTypes) {
+			params[i] = c.annotationType(function.ParamTypes[i])
+		}
+	}
+
+	return &signatureType{params: params, returnType: c.annotationType(function.ReturnType)}
+}
+
+// annotationType converts a type annotation into a type, a missing annotation is type any
+func (c *Checker) annotationType(annotation *ast.TypeAnnotation) Type {
+	if annotation == nil {
+		return anyType
+	}
+
+	var t Type
+	name := annotation.Name.Lexeme
+	switch name {
+	case "array":
+		t = &arrayType{element: c.typeArgument(annotation)}
+	case "map":
+		t = &mapType{value: c.typeArgument(annotation)}
+	default:
+		if builtin, ok := builtinTypes[name]; ok {
+			t = builtin
+		} else if class, ok := c.lookup(annotation.Name).(*classType); ok {
+			t = &instanceType{class: class}
+		} else {
+			c.errors.TypeError(annotation.Name, "Unknown type '"+name+"'")
+			return anyType
+		}
+
+		if len(annotation.Arguments) > 0 {
+			c.errors.TypeError(annotation.Name, "Type '"+name+"' does not take type arguments")
+		}
+	}
+
+	if annotation.Nullable {
+		return nullable(t)
+	}
+	return t
+}
+
+func (c *Checker) typeArgument(annotation *ast.TypeAnnotation) Type {
+	switch len(annotation.Arguments) {
+	case 0:
+		return anyType
+	case 1:
+		return c.annotationType(annotation.Arguments[0])
+	}
+
+	c.errors.TypeError(annotation.Name, "Type '"+annotation.Name.Lexeme+"' takes a single type argument")
+	return anyType
+}
+
+func (c *Checker) expectAssignable(t *token.Token, to, from Type, message string) {
+	if !isAssignable(to, from) {
+		c.errors.TypeError(t, fmt.Sprintf("%s: expected %s but got %s", message, to, from))
+	}
+}
+
+func (c *Checker) expectNumber(operator *token.Token, t Type) {
+	if isKnown(t) && t != numberType {
+		c.errors.TypeError(operator, fmt.Sprintf("Operand of '%s' must be a number but got %s", operator.Lexeme, t))
+	}
+}
+
+// expectOrdered checks that two values can be compared: two numbers, two strings or two arrays
+func (c *Checker) expectOrdered(operator *token.Token, left, right Type) {
+	if !isKnown(left) || !isKnown(right) {
+		return
+	}
+
+	_, leftIsArray := left.(*arrayType)
+	_, rightIsArray := right.(*arrayType)
+	if (left == numberType && right == numberType) || (left == stringType && right == stringType) || (leftIsArray && rightIsArray) {
+		return
+	}
+
+	c.errors.TypeError(operator, fmt.Sprintf("Operator '%s' cannot be applied to %s and %s", operator.Lexeme, left, right))
+}
+
+func (c *Checker) beginScope() {
+	c.scopes = append(c.scopes, map[string]variable{})
+}
+
+func (c *Checker) endScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *Checker) define(name *token.Token, t Type) {
+	c.scopes[len(c.scopes)-1][name.Lexeme] = variable{value: t, declared: t}
+}
+
+// defineInferred defines a variable whose type is known but which can be reassigned to any value
+func (c *Checker) defineInferred(name *token.Token, t Type) {
+	c.scopes[len(c.scopes)-1][name.Lexeme] = variable{value: t, declared: anyType}
+}
+
+func (c *Checker) lookupVariable(name *token.Token) variable {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if v, ok := c.scopes[i][name.Lexeme]; ok {
+			return v
+		}
+	}
+
+	// globals defined outside of the program, e.g. natives
+	return variable{value: anyType, declared: anyType}
+}
+
+// assign records that a variable has been assigned a new value. As the checker doesn't follow
+// control flow, a variable without a declared type can no longer be assumed to have its inferred type.
+func (c *Checker) assign(name *token.Token) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if v, ok := c.scopes[i][name.Lexeme]; ok {
+			c.scopes[i][name.Lexeme] = variable{value: v.declared, declared: v.declared}
+			return
+		}
+	}
+}
+
+func (c *Checker) lookup(name *token.Token) Type {
+	return c.lookupVariable(name).value
+}
+
+// Checker implements ast.StatementVisitor.
+func (c *Checker) VisitExpressionStatement(s *ast.ExpressionStatement) {
+	c.checkExpression(s.Expr)
+}
+
+func (c *Checker) VisitVarStatement(s *ast.VarStatement) {
+	var value Type = nilType
+	if s.Initializer != nil {
+		value = c.checkExpression(s.Initializer)
+	}
+
+	if s.Type == nil {
+		// unannotated variables take the type of their initializer, unless it's nil
+		// in which case the variable will almost certainly be assigned something else
+		if value == nilType {
+			value = anyType
+		}
+		c.defineInferred(s.Name, value)
+		return
+	}
+
+	declared := c.annotationType(s.Type)
+	if s.Initializer != nil {
+		c.expectAssignable(s.Name, declared, value, "Invalid initializer for '"+s.Name.Lexeme+"'")
+	}
+	c.define(s.Name, declared)
+}
+
+func (c *Checker) VisitBlockStatement(s *ast.BlockStatement) {
+	c.beginScope()
+	c.checkStatements(s.Statements)
+	c.endScope()
+}
+
+func (c *Checker) VisitIfStatement(s *ast.IfStatement) {
+	c.checkExpression(s.Condition)
+	c.checkStatement(s.Consequence)
+	if s.Alternative != nil {
+		c.checkStatement(s.Alternative)
+	}
+}
+
+func (c *Checker) VisitLoopStatement(s *ast.LoopStatement) {
+	c.checkExpression(s.Condition)
+	c.checkStatement(s.Body)
+	if s.Increment != nil {
+		c.checkExpression(s.Increment)
+	}
+}
+
+func (c *Checker) VisitForEachStatement(s *ast.ForEachStatement) {
+	element := elementType(c.checkExpression(s.Array))
+
+	c.beginScope()
+	c.define(s.VariableName, element)
+	c.checkStatement(s.Body)
+	c.endScope()
+}
+
+func (c *Checker) checkDecorators(decorators []ast.Expression) {
+	for _, decorator := range decorators {
+		c.checkExpression(decorator)
+	}
+}
+
+func (c *Checker) VisitFunctionStatement(s *ast.FunctionStatement) {
+	c.checkDecorators(s.Decorators)
+	signature := c.signature(s)
+
+	// define before checking the body to allow recursion
+	if len(s.Decorators) > 0 {
+		c.defineInferred(s.Name, anyType)
+	} else {
+		c.defineInferred(s.Name, signature)
+	}
+	c.checkFunction(s, signature)
+}
+
+func (c *Checker) VisitDeferStatement(s *ast.DeferStatement) {
+	c.checkExpression(s.Call)
+}
+
+func (c *Checker) VisitAssertStatement(s *ast.AssertStatement) {
+	c.checkExpression(s.Condition)
+	if s.Message != nil {
+		c.checkExpression(s.Message)
+	}
+}
+
+func (c *Checker) VisitReturnStatement(s *ast.ReturnStatement) {
+	var value Type = nilType
+	if s.Value != nil {
+		value = c.checkExpression(s.Value)
+	}
+
+	if c.returnType != nil {
+		c.expectAssignable(s.Keyword, c.returnType, value, "Invalid return value")
+	}
+}
+
+func (c *Checker) VisitBreakStatement(s *ast.BreakStatement) {}
+
+func (c *Checker) VisitContinueStatement(s *ast.ContinueStatement) {}
+
+func (c *Checker) VisitClassStatement(s *ast.ClassStatement) {
+	c.checkDecorators(s.Decorators)
+	for _, method := range s.Methods {
+		c.checkDecorators(method.Decorators)
+	}
+
+	class, ok := c.classes[s]
+	if !ok {
+		class = newClassType(s.Name.Lexeme)
+		c.classes[s] = class
+		c.defineClass(s, class)
+		c.defineMembers(s, class)
+	}
+
+	c.checkClass(s, class)
+}
+
+// checkClass checks the superclass and methods of a class, which may be declared
+// by a statement or be the class of an anonymous class or object literal
+func (c *Checker) checkClass(s *ast.ClassStatement, class *classType) {
+	if s.Superclass != nil {
+		c.checkExpression(s.Superclass)
+	}
+
+	enclosingThis := c.thisType
+	for _, method := range s.Methods {
+		if method.Kind == ast.STATIC_METHOD {
+			c.thisType = class
+		} else {
+			c.thisType = &instanceType{class: class}
+		}
+		c.checkFunction(method, c.signature(method))
+	}
+	c.thisType = enclosingThis
+}
+
+// Checker implements ast.ExpressionVisitor.
+func (c *Checker) VisitBinaryExpression(e *ast.BinaryExpression) any {
+	left := c.checkExpression(e.Left)
+	right := c.checkExpression(e.Right)
+	operator := e.Operator
+
+	switch operator.Type {
+	case token.EQUAL_EQUAL, token.BANG_EQUAL:
+		return booleanType
+	case token.PLUS:
+		if left == numberType && right == numberType {
+			return numberType
+		}
+		if left == stringType || right == stringType {
+			other := right
+			if left != stringType {
+				other = left
+			}
+			if isKnown(other) && other != stringType && other != numberType && other != booleanType {
+				c.errors.TypeError(operator, fmt.Sprintf("Cannot concatenate string with %s", other))
+			}
+			return stringType
+		}
+		leftArray, leftIsArray := left.(*arrayType)
+		rightArray, rightIsArray := right.(*arrayType)
+		if leftIsArray && rightIsArray {
+			return &arrayType{element: join(leftArray.element, rightArray.element)}
+		}
+		if isKnown(left) && isKnown(right) {
+			c.errors.TypeError(operator, fmt.Sprintf("Operator '+' cannot be applied to %s and %s", left, right))
+		}
+		return anyType
+	case token.MINUS, token.SLASH, token.STAR:
+		c.expectNumber(operator, left)
+		c.expectNumber(operator, right)
+		return numberType
+	case token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+		c.expectOrdered(operator, left, right)
+		return booleanType
+	case token.IN, token.NOT_IN:
+		if right == stringType && isKnown(left) && left != stringType {
+			c.errors.TypeError(operator, fmt.Sprintf("Only a string can be searched for in a string, not %s", left))
+		} else if right == numberType || right == booleanType || right == nilType {
+			c.errors.TypeError(operator, fmt.Sprintf("Operator '%s' cannot be applied to %s", operator.Lexeme, right))
+		}
+		return booleanType
+	}
+
+	return anyType
+}
+
+func (c *Checker) VisitTernaryExpression(e *ast.TernaryExpression) any {
+	c.checkExpression(e.Condition)
+	return join(c.checkExpression(e.Consequence), c.checkExpression(e.Alternative))
+}
+
+func (c *Checker) VisitLogicalExpression(e *ast.LogicalExpression) any {
+	return join(c.checkExpression(e.Left), c.checkExpression(e.Right))
+}
+
+func (c *Checker) VisitGroupedExpression(e *ast.GroupingExpression) any {
+	return c.checkExpression(e.Expr)
+}
+
+func (c *Checker) VisitUnaryExpression(e *ast.UnaryExpression) any {
+	operand := c.checkExpression(e.Expr)
+
+	if e.Operator.Type == token.MINUS {
+		c.expectNumber(e.Operator, operand)
+		return numberType
+	}
+
+	return booleanType
+}
+
+func (c *Checker) VisitLiteralExpression(e *ast.LiteralExpression) any {
+	switch e.Value.(type) {
+	case nil:
+		return nilType
+	case float64:
+		return numberType
+	case string:
+		return stringType
+	case bool:
+		return booleanType
+	}
+	return anyType
+}
+
+func (c *Checker) VisitVariableExpression(e *ast.VariableExpression) any {
+	return c.lookup(e.Name)
+}
+
+func (c *Checker) VisitAssignmentExpression(e *ast.AssignmentExpression) any {
+	value := c.checkExpression(e.Value)
+	c.expectAssignable(e.Name, c.lookupVariable(e.Name).declared, value, "Invalid assignment to '"+e.Name.Lexeme+"'")
+	c.assign(e.Name)
+	return value
+}
+
+func (c *Checker) VisitCallExpression(e *ast.CallExpression) any {
+	callee := c.checkExpression(e.Callee)
+	arguments := make([]Type, len(e.Arguments))
+	for i, argument := range e.Arguments {
+		arguments[i] = c.checkExpression(argument)
+	}
+
+	return c.checkCall(e.ClosingParen, callee, arguments)
+}
+
+func (c *Checker) VisitPipelineExpression(e *ast.PipelineExpression) any {
+	left := c.checkExpression(e.Left)
+	callee := c.checkExpression(e.Callee)
+	arguments := make([]Type, len(e.Arguments))
+	for i, argument := range e.Arguments {
+		if argument == nil {
+			arguments[i] = left
+		} else {
+			arguments[i] = c.checkExpression(argument)
+		}
+	}
+
+	return c.checkCall(e.Operator, callee, arguments)
+}
+
+func (c *Checker) checkCall(t *token.Token, callee Type, arguments []Type) Type {
+	switch callee := callee.(type) {
+	case *signatureType:
+		c.checkArguments(t, callee, arguments)
+		return callee.returnType
+	case *classType:
+		if initializer := callee.findMethod("init"); initializer != nil {
+			c.checkArguments(t, initializer, arguments)
+		}
+		return &instanceType{class: callee}
+	}
+
+	if isKnown(callee) && callee != functionType {
+		c.errors.TypeError(t, fmt.Sprintf("Can't call value of type %s", callee))
+	}
+	return anyType
+}
+
+func (c *Checker) checkArguments(paren *token.Token, signature *signatureType, arguments []Type) {
+	if len(arguments) != len(signature.params) {
+		c.errors.TypeError(paren, fmt.Sprintf("Expected %d arguments but got %d", len(signature.params), len(arguments)))
+		return
+	}
+
+	for i, argument := range arguments {
+		c.expectAssignable(paren, signature.params[i], argument, fmt.Sprintf("Invalid argument %d", i+1))
+	}
+}
+
+func (c *Checker) VisitLambdaExpression(e *ast.LambdaExpression) any {
+	signature := c.signature(e.Function)
+	c.checkFunction(e.Function, signature)
+	return signature
+}
+
+func (c *Checker) VisitClassExpression(e *ast.ClassExpression) any {
+	for _, method := range e.Class.Methods {
+		c.checkDecorators(method.Decorators)
+	}
+
+	class := newClassType(e.Class.Name.Lexeme)
+	c.defineMembers(e.Class, class)
+	c.checkClass(e.Class, class)
+	return class
+}
+
+func (c *Checker) VisitObjectExpression(e *ast.ObjectExpression) any {
+	class := newClassType(e.Class.Name.Lexeme)
+	for idx, field := range e.Fields {
+		c.checkExpression(e.Values[idx])
+		// like variables without annotations, fields can be reassigned to any value
+		class.fields[field.Lexeme] = anyType
+	}
+	for _, method := range e.Class.Methods {
+		c.checkDecorators(method.Decorators)
+	}
+
+	c.defineMembers(e.Class, class)
+	c.checkClass(e.Class, class)
+	return &instanceType{class: class}
+}
+
+func (c *Checker) VisitSequenceExpression(e *ast.SequenceExpression) any {
+	var result Type = nilType
+	for _, item := range e.Items {
+		result = c.checkExpression(item)
+	}
+	return result
+}
+
+func (c *Checker) VisitArrayExpression(e *ast.ArrayExpression) any {
+	var element Type = nil
+	for _, item := range e.Items {
+		var itemType Type
+		if spread, ok := item.(*ast.SpreadExpression); ok {
+			itemType = elementType(c.checkSpread(spread, "Only arrays and ranges can be spread into an array literal", isIterable))
+		} else {
+			itemType = c.checkExpression(item)
+		}
+
+		if element == nil {
+			element = itemType
+		} else {
+			element = join(element, itemType)
+		}
+	}
+
+	if element == nil {
+		element = anyType
+	}
+	return &arrayType{element: element}
+}
+
+func (c *Checker) VisitMapExpression(e *ast.MapExpression) any {
+	var value Type = nil
+	for i := range e.Keys {
+		var valueType Type
+		if spread, ok := e.Keys[i].(*ast.SpreadExpression); ok {
+			valueType = anyType
+			if m, ok := c.checkSpread(spread, "Only maps can be spread into a map literal", isMap).(*mapType); ok {
+				valueType = m.value
+			}
+		} else {
+			// keys of any type are allowed, as long as they are frozen, which isn't known statically
+			c.checkExpression(e.Keys[i])
+			valueType = c.checkExpression(e.Values[i])
+		}
+
+		if value == nil {
+			value = valueType
+		} else {
+			value = join(value, valueType)
+		}
+	}
+
+	if value == nil {
+		value = anyType
+	}
+	return &mapType{value: value}
+}
+
+// checkSpread checks the value of a spread, which must be of a type accepted by valid if it is known
+func (c *Checker) checkSpread(e *ast.SpreadExpression, message string, valid func(Type) bool) Type {
+	t := c.checkExpression(e.Expr)
+	if isKnown(t) && !valid(t) {
+		c.errors.TypeError(e.Operator, fmt.Sprintf("%s, not %s", message, t))
+	}
+	return t
+}
+
+func isIterable(t Type) bool {
+	_, isArray := t.(*arrayType)
+	return isArray || t == rangeType
+}
+
+func isMap(t Type) bool {
+	_, ok := t.(*mapType)
+	return ok
+}
+
+func (c *Checker) VisitSpreadExpression(e *ast.SpreadExpression) any {
+	return c.checkExpression(e.Expr)
+}
+
+func (c *Checker) VisitComprehensionExpression(e *ast.ComprehensionExpression) any {
+	scopes := 0
+	for _, clause := range e.Clauses {
+		if clause.Variable == nil {
+			c.checkExpression(clause.Condition)
+			continue
+		}
+
+		c.beginScope()
+		c.define(clause.Variable, elementType(c.checkExpression(clause.Iterable)))
+		scopes++
+	}
+
+	var result Type
+	if e.Key != nil {
+		c.checkExpression(e.Key)
+		result = &mapType{value: c.checkExpression(e.Value)}
+	} else {
+		result = &arrayType{element: c.checkExpression(e.Value)}
+	}
+
+	for ; scopes > 0; scopes-- {
+		c.endScope()
+	}
+	return result
+}
+
+func (c *Checker) VisitIndexExpression(e *ast.IndexExpression) any {
+	object := c.checkExpression(e.Object)
+	var index Type = anyType
+	for _, expression := range []ast.Expression{e.LeftIndex, e.RightIndex, e.Step} {
+		if expression != nil {
+			index = c.checkExpression(expression)
+		}
+	}
+
+	switch object := object.(type) {
+	case *arrayType:
+		if e.Slice || index == rangeType {
+			return object
+		}
+		return object.element
+	case *mapType:
+		return object.value
+	}
+
+	if object == stringType {
+		return stringType
+	}
+	return anyType
+}
+
+func (c *Checker) VisitRangeExpression(e *ast.RangeExpression) any {
+	c.expectNumber(e.Operator, c.checkExpression(e.Start))
+	c.expectNumber(e.Operator, c.checkExpression(e.End))
+	if e.Step != nil {
+		c.expectNumber(e.Operator, c.checkExpression(e.Step))
+	}
+	return rangeType
+}
+
+// elementType is the type of the elements produced by iterating over a value
+func elementType(iterable Type) Type {
+	if array, ok := iterable.(*arrayType); ok {
+		return array.element
+	}
+	if iterable == rangeType {
+		return numberType
+	}
+	return anyType
+}
+
+func (c *Checker) VisitIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression) any {
+	object := c.checkExpression(e.Left.Object)
+	for _, expression := range []ast.Expression{e.Left.LeftIndex, e.Left.RightIndex, e.Left.Step} {
+		if expression != nil {
+			c.checkExpression(expression)
+		}
+	}
+	value := c.checkExpression(e.Value)
+
+	switch object := object.(type) {
+	case *arrayType:
+		if e.Left.Slice {
+			c.expectAssignable(e.Left.ClosingBracket, object, value, "Invalid slice assignment")
+		} else {
+			c.expectAssignable(e.Left.ClosingBracket, object.element, value, "Invalid array element")
+		}
+	case *mapType:
+		c.expectAssignable(e.Left.ClosingBracket, object.value, value, "Invalid map value")
+	}
+
+	return value
+}
+
+func (c *Checker) VisitGetExpression(e *ast.GetExpression) any {
+	instance, ok := c.checkExpression(e.Object).(*instanceType)
+	if !ok {
+		return anyType
+	}
+
+	if field := instance.class.findField(e.Name.Lexeme); field != nil {
+		return field
+	}
+	if getter := instance.class.findGetter(e.Name.Lexeme); getter != nil {
+		return getter
+	}
+	if method := instance.class.findMethod(e.Name.Lexeme); method != nil {
+		return method
+	}
+
+	return anyType
+}
+
+func (c *Checker) VisitSetExpression(e *ast.SetExpression) any {
+	value := c.checkExpression(e.Value)
+	instance, ok := c.checkExpression(e.Object).(*instanceType)
+	if !ok {
+		return value
+	}
+
+	if instance.class.record {
+		c.errors.TypeError(e.Name, "Fields of record "+instance.class.name+" are read-only")
+	} else if field := instance.class.findField(e.Name.Lexeme); field != nil {
+		c.expectAssignable(e.Name, field, value, "Invalid value for field '"+e.Name.Lexeme+"'")
+	} else if setter := instance.class.findSetter(e.Name.Lexeme); setter != nil {
+		c.expectAssignable(e.Name, setter, value, "Invalid value for setter '"+e.Name.Lexeme+"'")
+	}
+
+	return value
+}
+
+func (c *Checker) VisitThisExpression(e *ast.ThisExpression) any {
+	return c.thisType
+}
+
+func (c *Checker) VisitSuperGetExpression(e *ast.SuperGetExpression) any {
+	return anyType
+}
+
+func (c *Checker) VisitSuperSetExpression(e *ast.SuperSetExpression) any {
+	return c.checkExpression(e.Value)
+}
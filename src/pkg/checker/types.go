@@ -0,0 +1,244 @@
+package checker
+
+import (
+	"strings"
+)
+
+// Type is the static type of an expression. The checker is gradual, so any expression
+// whose type can't be determined has type any, which is compatible with every other type.
+type Type interface {
+	String() string
+}
+
+type simpleType struct {
+	name string
+}
+
+func (t *simpleType) String() string {
+	return t.name
+}
+
+var (
+	anyType      = &simpleType{"any"}
+	nilType      = &simpleType{"nil"}
+	numberType   = &simpleType{"number"}
+	stringType   = &simpleType{"string"}
+	booleanType  = &simpleType{"boolean"}
+	functionType = &simpleType{"function"}
+	rangeType    = &simpleType{"range"}
+)
+
+var builtinTypes = map[string]Type{
+	"any":      anyType,
+	"nil":      nilType,
+	"number":   numberType,
+	"string":   stringType,
+	"boolean":  booleanType,
+	"function": functionType,
+	"range":    rangeType,
+}
+
+type nullableType struct {
+	inner Type
+}
+
+func (t *nullableType) String() string {
+	return t.inner.String() + "?"
+}
+
+type arrayType struct {
+	element Type
+}
+
+func (t *arrayType) String() string {
+	if t.element == anyType {
+		return "array"
+	}
+	return "array<" + t.element.String() + ">"
+}
+
+type mapType struct {
+	value Type
+}
+
+func (t *mapType) String() string {
+	if t.value == anyType {
+		return "map"
+	}
+	return "map<" + t.value.String() + ">"
+}
+
+type signatureType struct {
+	params     []Type
+	returnType Type
+}
+
+func (t *signatureType) String() string {
+	params := make([]string, len(t.params))
+	for i, param := range t.params {
+		params[i] = param.String()
+	}
+	return "fun(" + strings.Join(params, ", ") + "): " + t.returnType.String()
+}
+
+type classType struct {
+	name    string
+	record  bool
+	super   *classType
+	fields  map[string]Type
+	methods map[string]*signatureType
+	getters map[string]Type
+	setters map[string]Type
+}
+
+func newClassType(name string) *classType {
+	return &classType{
+		name:    name,
+		fields:  map[string]Type{},
+		methods: map[string]*signatureType{},
+		getters: map[string]Type{},
+		setters: map[string]Type{},
+	}
+}
+
+func (t *classType) String() string {
+	return "class " + t.name
+}
+
+func (t *classType) isSubclassOf(other *classType) bool {
+	for c := t; c != nil; c = c.super {
+		if c == other {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *classType) findField(name string) Type {
+	for c := t; c != nil; c = c.super {
+		if field, ok := c.fields[name]; ok {
+			return field
+		}
+	}
+	return nil
+}
+
+func (t *classType) findMethod(name string) *signatureType {
+	for c := t; c != nil; c = c.super {
+		if method, ok := c.methods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func (t *classType) findGetter(name string) Type {
+	for c := t; c != nil; c = c.super {
+		if getter, ok := c.getters[name]; ok {
+			return getter
+		}
+	}
+	return nil
+}
+
+func (t *classType) findSetter(name string) Type {
+	for c := t; c != nil; c = c.super {
+		if setter, ok := c.setters[name]; ok {
+			return setter
+		}
+	}
+	return nil
+}
+
+type instanceType struct {
+	class *classType
+}
+
+func (t *instanceType) String() string {
+	return t.class.name
+}
+
+// isAssignable reports whether a value of type from can be stored somewhere declared with type to
+func isAssignable(to, from Type) bool {
+	if to == anyType || from == anyType {
+		return true
+	}
+
+	if to, ok := to.(*nullableType); ok {
+		if from == nilType {
+			return true
+		}
+		if from, ok := from.(*nullableType); ok {
+			return isAssignable(to.inner, from.inner)
+		}
+		return isAssignable(to.inner, from)
+	}
+
+	switch to := to.(type) {
+	case *simpleType:
+		if to == functionType {
+			switch from.(type) {
+			case *signatureType, *classType:
+				return true
+			}
+		}
+		return to == from
+	case *arrayType:
+		if from, ok := from.(*arrayType); ok {
+			return isAssignable(to.element, from.element)
+		}
+	case *mapType:
+		if from, ok := from.(*mapType); ok {
+			return isAssignable(to.value, from.value)
+		}
+	case *signatureType:
+		if from, ok := from.(*signatureType); ok {
+			return len(to.params) == len(from.params)
+		}
+		return from == functionType
+	case *classType:
+		return to == from
+	case *instanceType:
+		if from, ok := from.(*instanceType); ok {
+			return from.class.isSubclassOf(to.class)
+		}
+	}
+
+	return false
+}
+
+// join returns the most specific type that both types can be assigned to
+func join(a, b Type) Type {
+	if a == b {
+		return a
+	}
+	if a == nilType {
+		return nullable(b)
+	}
+	if b == nilType {
+		return nullable(a)
+	}
+	if isAssignable(a, b) && a != anyType && b != anyType {
+		return a
+	}
+	if isAssignable(b, a) && a != anyType && b != anyType {
+		return b
+	}
+	return anyType
+}
+
+func nullable(t Type) Type {
+	switch t.(type) {
+	case *nullableType:
+		return t
+	}
+	if t == anyType || t == nilType {
+		return t
+	}
+	return &nullableType{t}
+}
+
+// isKnown reports whether a type gives the checker anything to check against
+func isKnown(t Type) bool {
+	return t != anyType
+}
@@ -0,0 +1,104 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hutcho66/glox/src/pkg/token"
+)
+
+// callFrame is a call of a Lox function that hasn't returned yet. When the function
+// makes a call in tail position, the frame is reused for the called function.
+type callFrame struct {
+	function  *LoxFunction
+	site      *token.Token
+	tailCalls int
+
+	// deferred is the number of deferred calls that were pending when the function was called
+	deferred int
+}
+
+// DefaultMaxCallDepth is the number of nested calls allowed before a stack overflow
+// error is raised, which leaves plenty of room in the Go stack
+const DefaultMaxCallDepth = 10000
+
+// SetMaxCallDepth sets the number of nested calls allowed before a stack overflow error is raised
+func (i *Interpreter) SetMaxCallDepth(depth int) {
+	i.maxCallDepth = depth
+}
+
+// pushFrame records a call of a function, failing if there are already as many
+// nested calls as allowed. Calls in tail position don't add to the depth.
+func (i *Interpreter) pushFrame(function *LoxFunction) (*callFrame, error) {
+	if len(i.frames) >= i.maxCallDepth {
+		return nil, errors.New(fmt.Sprintf("stack overflow: maximum call depth of %d exceeded calling %s", i.maxCallDepth, function.describe()))
+	}
+
+	frame := &callFrame{function: function, site: i.callSite, deferred: len(i.deferred)}
+	i.frames = append(i.frames, frame)
+	return frame, nil
+}
+
+func (i *Interpreter) popFrame() {
+	i.frames = i.frames[:len(i.frames)-1]
+}
+
+// runtimeError reports a runtime error, followed by the calls that led to it
+func (i *Interpreter) runtimeError(t *token.Token, message string) error {
+	return i.errors.RuntimeError(t, message+i.stackTrace())
+}
+
+// maxTraceLines is the number of lines of a stack trace shown before the middle of it is left out
+const maxTraceLines = 20
+
+// stackTrace describes the active calls, innermost first, with runs of identical
+// frames (as left by deep recursion) collapsed into one line
+func (i *Interpreter) stackTrace() string {
+	lines, frames := []string{}, []int{}
+	for idx := len(i.frames) - 1; idx >= 0; {
+		frame := i.frames[idx]
+		repeats := 1
+		for idx-repeats >= 0 && i.frames[idx-repeats].describe() == frame.describe() {
+			repeats++
+		}
+		idx -= repeats
+
+		if repeats > 1 {
+			lines = append(lines, fmt.Sprintf("%s (repeated %d times)", frame.describe(), repeats))
+		} else {
+			lines = append(lines, frame.describe())
+		}
+		frames = append(frames, repeats)
+	}
+
+	if len(lines) > maxTraceLines {
+		// recursion through several functions doesn't collapse, so show only the innermost and outermost calls
+		omitted := 0
+		for _, count := range frames[maxTraceLines/2 : len(lines)-maxTraceLines/2] {
+			omitted += count
+		}
+		kept := append([]string{}, lines[:maxTraceLines/2]...)
+		kept = append(kept, fmt.Sprintf("... %d more calls", omitted))
+		lines = append(kept, lines[len(lines)-maxTraceLines/2:]...)
+	}
+
+	var trace strings.Builder
+	for _, line := range lines {
+		trace.WriteString("\n    " + line)
+	}
+	return trace.String()
+}
+
+func (f *callFrame) describe() string {
+	description := "in " + f.function.name()
+	if f.site != nil {
+		description += fmt.Sprintf(", called at line %d", f.site.Line)
+	}
+	if f.tailCalls == 1 {
+		description += " after 1 tail call"
+	} else if f.tailCalls > 1 {
+		description += fmt.Sprintf(" after %d tail calls", f.tailCalls)
+	}
+	return description
+}
@@ -11,9 +11,18 @@ type LoxClass struct {
 	Name    string
 	Methods map[string]*LoxFunction
 	Super   *LoxClass
+	Doc     string
+
+	// Record is set for records, whose instances have exactly the given Fields
+	Record bool
+	Fields []string
 }
 
 func (c LoxClass) Arity() int {
+	if c.Record {
+		return len(c.Fields)
+	}
+
 	initializer := c.findMethod("init")
 	if initializer == nil {
 		return 0
@@ -23,11 +32,17 @@ func (c LoxClass) Arity() int {
 }
 
 func (c *LoxClass) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	if c.Record {
+		return c.newRecord(arguments), nil
+	}
+
 	instance := NewLoxInstance(c)
 
 	initializer := c.findMethod("init")
 	if initializer != nil {
-		initializer.bind(instance).Call(interpreter, arguments)
+		if _, err := initializer.bind(instance).Call(interpreter, arguments); err != nil {
+			return nil, err
+		}
 	}
 
 	return instance, nil
@@ -1,5 +1,7 @@
 package interpreter
 
+import "github.com/hutcho66/glox/src/pkg/token"
+
 type ControlType string
 
 const (
@@ -11,12 +13,45 @@ const (
 type LoxControl struct {
 	controlType ControlType
 	value       any
+	label       string
+
+	// set when returning a call in tail position, which the caller runs in place of the returning function
+	function  *LoxFunction
+	arguments []any
 }
 
 func LoxReturn(value any) *LoxControl {
 	return &LoxControl{controlType: RETURN, value: value}
 }
 
+func LoxTailCall(function *LoxFunction, arguments []any) *LoxControl {
+	return &LoxControl{controlType: RETURN, function: function, arguments: arguments}
+}
+
 var LoxBreak = &LoxControl{controlType: BREAK}
 
 var LoxContinue = &LoxControl{controlType: CONTINUE}
+
+func LoxLabeledBreak(label string) *LoxControl {
+	return &LoxControl{controlType: BREAK, label: label}
+}
+
+func LoxLabeledContinue(label string) *LoxControl {
+	return &LoxControl{controlType: CONTINUE, label: label}
+}
+
+// isLoopControl reports whether a recovered panic value is a break or continue
+// that should be handled by the loop with the given label (which may be nil)
+func isLoopControl(val any, controlType ControlType, label *token.Token) bool {
+	control, ok := val.(*LoxControl)
+	if !ok || control.controlType != controlType {
+		return false
+	}
+
+	// unlabeled break and continue always target the innermost loop
+	if control.label == "" {
+		return true
+	}
+
+	return label != nil && label.Lexeme == control.label
+}
@@ -23,6 +23,16 @@ func NewEnclosingEnvironment(enclosing *Environment) *Environment {
 	}
 }
 
+// copy creates an environment with the same enclosing environment and values,
+// which can then be changed independently of this one
+func (e *Environment) copy() *Environment {
+	values := make(map[string]any, len(e.values))
+	for name, value := range e.values {
+		values[name] = value
+	}
+	return &Environment{enclosing: e.enclosing, values: values}
+}
+
 func (e *Environment) get(name *token.Token) (any, bool) {
 	val, ok := e.values[name.Lexeme]
 	return val, ok
@@ -0,0 +1,147 @@
+package interpreter
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hutcho66/glox/src/pkg/ast"
+)
+
+// comparison is a pair of compound values that are being compared, used to
+// detect cycles so that comparing cyclic structures terminates
+type comparison struct {
+	left, right any
+}
+
+// isEqual compares two values structurally: arrays are equal if their elements are equal,
+// maps are equal if they have the same keys with equal values, records are equal if their
+// fields are equal, and other instances are only equal to themselves unless their class
+// defines an equals method.
+func (i *Interpreter) isEqual(left, right any) bool {
+	return i.deepEqual(left, right, map[comparison]bool{})
+}
+
+func (i *Interpreter) deepEqual(left, right any, visiting map[comparison]bool) bool {
+	switch l := left.(type) {
+	case *LoxArray:
+		r, ok := right.(*LoxArray)
+		if !ok {
+			return false
+		}
+		if l == r {
+			return true
+		}
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+
+		// if this pair is already being compared further up, any difference will be found there
+		pair := comparison{l, r}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for idx := range l.Elements {
+			if !i.deepEqual(l.Elements[idx], r.Elements[idx], visiting) {
+				return false
+			}
+		}
+		return true
+	case *LoxMap:
+		r, ok := right.(*LoxMap)
+		if !ok {
+			return false
+		}
+		if l == r {
+			return true
+		}
+		if len(l.Pairs) != len(r.Pairs) {
+			return false
+		}
+
+		pair := comparison{l, r}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for hash, leftPair := range l.Pairs {
+			rightPair, ok := r.Pairs[hash]
+			if !ok || !i.deepEqual(leftPair.Value, rightPair.Value, visiting) {
+				return false
+			}
+		}
+		return true
+	case *LoxInstance:
+		if equals := l.Class.equalsMethod(); equals != nil {
+			result, _ := equals.bind(l).Call(i, []any{right})
+			return isTruthy(result)
+		}
+		if r, ok := right.(*LoxInstance); ok && l.Class.Record && r.Class == l.Class {
+			return i.recordEqual(l, r, visiting)
+		}
+		return left == right
+	}
+
+	return left == right
+}
+
+// equalsMethod is the method instances of a class are compared with, if it has one
+func (c *LoxClass) equalsMethod() *LoxFunction {
+	if equals := c.findMethod("equals"); equals != nil && equals.declaration.Kind == ast.NORMAL_METHOD && equals.Arity() == 1 {
+		return equals
+	}
+	return nil
+}
+
+// hashMethod is the method instances of a class with an equals method are hashed with, if it has one
+func (c *LoxClass) hashMethod() *LoxFunction {
+	if hash := c.findMethod("hash"); hash != nil && hash.declaration.Kind == ast.NORMAL_METHOD && hash.Arity() == 0 {
+		return hash
+	}
+	return nil
+}
+
+// compare orders two values, returning a negative number if left is less than right,
+// zero if they are equal and a positive number if left is greater than right.
+// Numbers and strings are ordered as usual, and arrays are ordered lexicographically.
+func (i *Interpreter) compare(left, right any) (int, error) {
+	return i.deepCompare(left, right, map[comparison]bool{})
+}
+
+func (i *Interpreter) deepCompare(left, right any, visiting map[comparison]bool) (int, error) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return cmp.Compare(l, r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	case *LoxArray:
+		if r, ok := right.(*LoxArray); ok {
+			pair := comparison{l, r}
+			if l == r || visiting[pair] {
+				return 0, nil
+			}
+			visiting[pair] = true
+			defer delete(visiting, pair)
+
+			for idx := 0; idx < len(l.Elements) && idx < len(r.Elements); idx++ {
+				order, err := i.deepCompare(l.Elements[idx], r.Elements[idx], visiting)
+				if err != nil || order != 0 {
+					return order, err
+				}
+			}
+			return cmp.Compare(len(l.Elements), len(r.Elements)), nil
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("cannot compare %s with %s", typeName(left), typeName(right)))
+}
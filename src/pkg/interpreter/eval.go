@@ -0,0 +1,123 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hutcho66/glox/src/pkg/ast"
+	"github.com/hutcho66/glox/src/pkg/lox_error"
+	"github.com/hutcho66/glox/src/pkg/parser"
+	"github.com/hutcho66/glox/src/pkg/resolver"
+	"github.com/hutcho66/glox/src/pkg/scanner"
+)
+
+// sourceErrors collects the errors found scanning, parsing and resolving source passed
+// to eval, so they can be raised as a runtime error rather than reported straight away
+type sourceErrors struct {
+	messages []string
+}
+
+func (s *sourceErrors) Report(line int, where, message string) {
+	s.messages = append(s.messages, fmt.Sprintf("[line %d] Error%s: %s", line, where, message))
+}
+
+// eval runs source in its own scope, which holds the given variables and can see the globals
+// but not the scope eval was called from. It returns the value of the last statement if that
+// is an expression, like Interpret. Runtime errors in the source are raised as usual.
+// The source is resolved into its own locals, so nothing is kept once it can't be used.
+func (i *Interpreter) eval(source string, variables map[string]any) (any, error) {
+	reporter := &sourceErrors{}
+	loxErrors := lox_error.NewLoxErrors(reporter)
+
+	tokens := scanner.NewScanner(source, loxErrors).ScanTokens()
+	var statements []ast.Statement
+	if !loxErrors.HadScanningError() {
+		statements = parser.NewParser(tokens, loxErrors).Parse()
+	}
+
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sourceLocals := locals{}
+	if !loxErrors.HadParsingError() {
+		resolver.NewResolver(sourceLocals, loxErrors).ResolveScope(statements, names)
+	}
+
+	if len(reporter.messages) > 0 {
+		return nil, errors.New("invalid source passed to eval: " + strings.Join(reporter.messages, "; "))
+	}
+
+	environment := NewEnclosingEnvironment(i.globals)
+	for name, value := range variables {
+		environment.define(name, value)
+	}
+
+	previous, previousLocals := i.environment, i.locals
+	i.environment, i.locals = environment, sourceLocals
+	defer func() {
+		i.environment, i.locals = previous, previousLocals
+	}()
+	defer i.runDeferred(len(i.deferred))
+
+	var value any = nil
+	for idx, s := range statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && idx == len(statements)-1 {
+			value = i.evaluate(es.Expr)
+		} else {
+			i.execute(s)
+		}
+	}
+	return value, nil
+}
+
+type Eval struct{}
+
+func (Eval) Arity() int {
+	return 1
+}
+
+func (Eval) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	source, isString := arguments[0].(string)
+	if !isString {
+		return nil, errors.New("argument of eval must be a string")
+	}
+	return interpreter.eval(source, map[string]any{})
+}
+
+func (Eval) Name() string {
+	return "eval"
+}
+
+type EvalWith struct{}
+
+func (EvalWith) Arity() int {
+	return 2
+}
+
+func (EvalWith) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	source, isString := arguments[0].(string)
+	if !isString {
+		return nil, errors.New("first argument of evalWith must be a string")
+	}
+
+	m, isMap := arguments[1].(*LoxMap)
+	if !isMap {
+		return nil, errors.New("second argument of evalWith must be a map")
+	}
+
+	variables := make(map[string]any, len(m.Pairs))
+	for _, pair := range m.Pairs {
+		name, isName := pair.Key.(string)
+		if !isName {
+			return nil, errors.New("variable names passed to evalWith must be strings")
+		}
+		variables[name] = pair.Value
+	}
+	return interpreter.eval(source, variables)
+}
+
+func (EvalWith) Name() string {
+	return "evalWith"
+}
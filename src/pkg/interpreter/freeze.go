@@ -0,0 +1,264 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// freeze stops an array, map or instance from being modified. A deep freeze also
+// freezes every value it contains, so the whole structure becomes immutable.
+func freeze(value any, deep bool, visited map[any]bool) {
+	if visited[value] {
+		return
+	}
+
+	switch v := value.(type) {
+	case *LoxArray:
+		visited[v] = true
+		v.Frozen = true
+		if deep {
+			for _, element := range v.Elements {
+				freeze(element, deep, visited)
+			}
+		}
+	case *LoxMap:
+		visited[v] = true
+		v.Frozen = true
+		if deep {
+			for _, pair := range v.Pairs {
+				freeze(pair.Value, deep, visited)
+			}
+		}
+	case *LoxInstance:
+		visited[v] = true
+		v.Frozen = true
+		if deep {
+			for _, field := range v.Fields {
+				freeze(field, deep, visited)
+			}
+		}
+	}
+}
+
+// isFrozen reports whether a value can't be modified. Only arrays, maps and instances can
+// be modified until they are frozen, values of every other type never change.
+func isFrozen(value any) bool {
+	switch v := value.(type) {
+	case *LoxArray:
+		return v.Frozen
+	case *LoxMap:
+		return v.Frozen
+	case *LoxInstance:
+		return v.Frozen
+	}
+	return true
+}
+
+// isImmutable reports whether a value and everything it contains is frozen, which is
+// required of map keys so that their hash can't change while they are in a map
+func isImmutable(value any, visited map[any]bool) bool {
+	if !isFrozen(value) {
+		return false
+	}
+	if visited[value] {
+		return true
+	}
+
+	switch v := value.(type) {
+	case *LoxArray:
+		visited[v] = true
+		for _, element := range v.Elements {
+			if !isImmutable(element, visited) {
+				return false
+			}
+		}
+	case *LoxMap:
+		visited[v] = true
+		for _, pair := range v.Pairs {
+			if !isImmutable(pair.Value, visited) {
+				return false
+			}
+		}
+	case *LoxInstance:
+		visited[v] = true
+		for _, field := range v.Fields {
+			if !isImmutable(field, visited) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Hash is the position of a key in a LoxMap. Frozen arrays, maps and records are hashed
+// by their contents, so equal keys find the same entry. Other instances are only equal to
+// themselves, so are hashed by identity, unless their class defines equals, in which case
+// they need a hash method that the interpreter calls, so Hash can't be used for them.
+func Hash(key any) int {
+	var i *Interpreter
+	hash, _ := i.hash(key)
+	return hash
+}
+
+// hash is the position of a key in a LoxMap, calling the hash method of any instance whose
+// class defines equals, which must return the same value for instances that are equal
+func (i *Interpreter) hash(key any) (int, error) {
+	h := fnv.New64a()
+	if err := i.writeHash(h, key, map[any]bool{}); err != nil {
+		return 0, err
+	}
+	return int(h.Sum64()), nil
+}
+
+func (i *Interpreter) writeHash(h hash.Hash64, key any, visiting map[any]bool) error {
+	switch k := key.(type) {
+	case nil:
+		h.Write([]byte("nil"))
+	case bool:
+		h.Write([]byte("bool:" + strconv.FormatBool(k)))
+	case float64:
+		if k == 0 {
+			// -0 == 0, so they must hash the same
+			k = 0
+		}
+		h.Write([]byte("number:" + strconv.FormatFloat(k, 'g', -1, 64)))
+	case string:
+		h.Write([]byte("string:" + strconv.Itoa(len(k)) + ":" + k))
+	case LoxRange:
+		h.Write([]byte(fmt.Sprintf("range:%v:%v:%v:%t", k.Start, k.End, k.Step, k.Inclusive)))
+	case *LoxArray:
+		if visiting[k] {
+			h.Write([]byte("cycle"))
+			return nil
+		}
+		visiting[k] = true
+		defer delete(visiting, k)
+
+		h.Write([]byte("array:" + strconv.Itoa(len(k.Elements))))
+		for _, element := range k.Elements {
+			if err := i.writeHash(h, element, visiting); err != nil {
+				return err
+			}
+		}
+	case *LoxMap:
+		if visiting[k] {
+			h.Write([]byte("cycle"))
+			return nil
+		}
+		visiting[k] = true
+		defer delete(visiting, k)
+
+		// pairs are stored in no particular order, so hash them in order of their key hashes
+		hashes := make([]int, 0, len(k.Pairs))
+		for hash := range k.Pairs {
+			hashes = append(hashes, hash)
+		}
+		slices.Sort(hashes)
+
+		h.Write([]byte("map:" + strconv.Itoa(len(hashes))))
+		for _, hash := range hashes {
+			h.Write([]byte(strconv.Itoa(hash)))
+			if err := i.writeHash(h, k.Pairs[hash].Value, visiting); err != nil {
+				return err
+			}
+		}
+	case *LoxInstance:
+		if visiting[k] {
+			h.Write([]byte("cycle"))
+			return nil
+		}
+		visiting[k] = true
+		defer delete(visiting, k)
+
+		if k.Class.equalsMethod() != nil {
+			return i.writeInstanceHash(h, k, visiting)
+		}
+		if !k.Class.Record {
+			h.Write([]byte(fmt.Sprintf("instance:%p", k)))
+			return nil
+		}
+
+		names := make([]string, 0, len(k.Fields))
+		for name := range k.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		h.Write([]byte(fmt.Sprintf("instance:%p", k.Class)))
+		for _, name := range names {
+			h.Write([]byte(name))
+			if err := i.writeHash(h, k.Fields[name], visiting); err != nil {
+				return err
+			}
+		}
+	default:
+		// functions and classes are only equal to themselves
+		h.Write([]byte(fmt.Sprintf("%T:%p", k, k)))
+	}
+	return nil
+}
+
+// writeInstanceHash hashes an instance compared by its equals method using its hash method.
+// equals can compare instances of different classes, so the class isn't part of the hash.
+func (i *Interpreter) writeInstanceHash(h hash.Hash64, instance *LoxInstance, visiting map[any]bool) error {
+	method := instance.Class.hashMethod()
+	if method == nil || i == nil {
+		return errors.New(fmt.Sprintf("instances of %s define equals, so need a hash method to be used as map keys", instance.Class.Name))
+	}
+
+	value, err := method.bind(instance).Call(i, []any{})
+	if err != nil {
+		return err
+	}
+	h.Write([]byte("hashed:"))
+	return i.writeHash(h, value, visiting)
+}
+
+type Freeze struct{}
+
+func (Freeze) Arity() int {
+	return 1
+}
+
+func (Freeze) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	freeze(arguments[0], true, map[any]bool{})
+	return arguments[0], nil
+}
+
+func (Freeze) Name() string {
+	return "freeze"
+}
+
+type FreezeShallow struct{}
+
+func (FreezeShallow) Arity() int {
+	return 1
+}
+
+func (FreezeShallow) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	freeze(arguments[0], false, map[any]bool{})
+	return arguments[0], nil
+}
+
+func (FreezeShallow) Name() string {
+	return "freezeShallow"
+}
+
+type IsFrozen struct{}
+
+func (IsFrozen) Arity() int {
+	return 1
+}
+
+func (IsFrozen) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return isFrozen(arguments[0]), nil
+}
+
+func (IsFrozen) Name() string {
+	return "isFrozen"
+}
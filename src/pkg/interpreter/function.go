@@ -1,16 +1,84 @@
 package interpreter
 
-import "github.com/hutcho66/glox/src/pkg/ast"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hutcho66/glox/src/pkg/ast"
+)
 
 type LoxFunction struct {
 	declaration   *ast.FunctionStatement
 	closure       *Environment
+	locals        locals
 	isInitializer bool
+	receiver      LoxObject
+
+	// wraps is the method a decorator wrapper replaces, which is bound to
+	// the same receiver as the wrapper when the wrapper calls it
+	wraps *LoxFunction
 }
 
-func (f *LoxFunction) Call(interpreter *Interpreter, arguments []any) (returnValue any, err error) {
-	enclosingEnvironment := interpreter.environment
+func (f *LoxFunction) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	f, err := interpreter.bindWrapped(f)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := interpreter.pushFrame(f)
+	if err != nil {
+		return nil, err
+	}
+	defer interpreter.popFrame()
+
+	function := f
+	for {
+		returnValue, tailCall := function.invoke(interpreter, arguments)
+		if tailCall == nil {
+			return returnValue, nil
+		}
+
+		// run the tail call in place of the function that returned it, so
+		// that recursion through tail calls doesn't grow the stack
+		function, arguments = tailCall.function, tailCall.arguments
+		frame.function = function
+		frame.tailCalls++
+	}
+}
+
+// invoke executes the body of the function, returning either its return value
+// or the call it returned in tail position, which the caller must run
+func (f *LoxFunction) invoke(interpreter *Interpreter, arguments []any) (returnValue any, tailCall *LoxControl) {
+	// the function may have been declared by source run by eval, which has its own locals
+	enclosingLocals := interpreter.locals
+	interpreter.locals = f.locals
+	defer func() {
+		interpreter.locals = enclosingLocals
+	}()
+
 	environment := NewEnclosingEnvironment(f.closure)
+	for i, param := range f.declaration.Params {
+		environment.define(param.Lexeme, arguments[i])
+	}
+
+	if !interpreter.assertions || (len(f.declaration.Requires) == 0 && len(f.declaration.Ensures) == 0) {
+		return f.run(interpreter, environment)
+	}
+
+	interpreter.checkConditions(f.declaration.Requires, environment)
+	returnValue, tailCall = f.run(interpreter, environment)
+	if tailCall == nil && len(f.declaration.Ensures) > 0 {
+		// the return value is in its own scope, so that it can shadow a parameter
+		result := NewEnclosingEnvironment(environment)
+		result.define("result", returnValue)
+		interpreter.checkConditions(f.declaration.Ensures, result)
+	}
+	return returnValue, tailCall
+}
+
+// run executes the body of the function in an environment holding its parameters
+func (f *LoxFunction) run(interpreter *Interpreter, environment *Environment) (returnValue any, tailCall *LoxControl) {
+	enclosingEnvironment := interpreter.environment
 
 	defer func() {
 		if val := recover(); val != nil {
@@ -22,6 +90,8 @@ func (f *LoxFunction) Call(interpreter *Interpreter, arguments []any) (returnVal
 
 			if f.isInitializer {
 				returnValue = f.closure.getAt(0, "this")
+			} else if rv.function != nil {
+				tailCall = rv
 			} else {
 				returnValue = rv.value
 			}
@@ -31,10 +101,6 @@ func (f *LoxFunction) Call(interpreter *Interpreter, arguments []any) (returnVal
 		}
 	}()
 
-	for i, param := range f.declaration.Params {
-		environment.define(param.Lexeme, arguments[i])
-	}
-
 	interpreter.executeBlock(f.declaration.Body, environment)
 
 	if f.isInitializer {
@@ -49,7 +115,51 @@ func (f LoxFunction) Arity() int {
 }
 
 func (f *LoxFunction) bind(instance LoxObject) *LoxFunction {
+	if f.wraps != nil {
+		// decorator wrappers are not declared inside the class, so they can't refer
+		// to this, but the method they wrap is bound to the receiver when called
+		return &LoxFunction{declaration: f.declaration, closure: f.closure, locals: f.locals, receiver: instance, wraps: f.wraps}
+	}
+
 	environment := NewEnclosingEnvironment(f.closure)
 	environment.define("this", instance)
-	return &LoxFunction{f.declaration, environment, f.isInitializer}
+	return &LoxFunction{declaration: f.declaration, closure: environment, locals: f.locals, isInitializer: f.isInitializer, receiver: instance}
+}
+
+// bindWrapped binds a method that was passed to a decorator, which can only be called
+// by the decorator's wrapper, to the receiver of the innermost call of that wrapper
+func (i *Interpreter) bindWrapped(f *LoxFunction) (*LoxFunction, error) {
+	if f.receiver != nil || f.declaration.Kind == ast.NOT_METHOD {
+		return f, nil
+	}
+
+	for idx := len(i.frames) - 1; idx >= 0; idx-- {
+		if wrapper := i.frames[idx].function; wrapper.wraps == f && wrapper.receiver != nil {
+			return f.bind(wrapper.receiver), nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Method '%s' can only be called by the decorator wrapping it, outside of which it has no instance", f.declaration.Name.Lexeme))
+}
+
+// name is how the function is described in stack traces
+func (f *LoxFunction) name() string {
+	if f.declaration.Name == nil {
+		return "lambda"
+	}
+
+	switch receiver := f.receiver.(type) {
+	case *LoxInstance:
+		return receiver.Class.Name + "." + f.declaration.Name.Lexeme
+	case *LoxClass:
+		return receiver.Name + "." + f.declaration.Name.Lexeme
+	}
+	return f.declaration.Name.Lexeme
+}
+
+// describe names the function and, unless it is a lambda, where it was declared
+func (f *LoxFunction) describe() string {
+	if f.declaration.Name == nil {
+		return f.name()
+	}
+	return fmt.Sprintf("%s, declared at line %d", f.name(), f.declaration.Name.Line)
 }
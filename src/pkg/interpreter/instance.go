@@ -9,6 +9,7 @@ import (
 type LoxInstance struct {
 	Class  *LoxClass
 	Fields map[string]any
+	Frozen bool
 }
 
 func NewLoxInstance(class *LoxClass) *LoxInstance {
@@ -28,9 +29,21 @@ func (i *LoxInstance) get(name *token.Token) (any, error) {
 		return method.bind(i), nil
 	}
 
+	if i.Class.Record && name.Lexeme == "with" {
+		return &BoundMethod{Receiver: i, Method: &recordWith{}, name: "with"}, nil
+	}
+
 	return nil, errors.New("Undefined property '" + name.Lexeme + "'.")
 }
 
-func (i *LoxInstance) set(name *token.Token, value any) {
+func (i *LoxInstance) set(name *token.Token, value any) error {
+	if i.Class.Record {
+		return errors.New("Cannot set property '" + name.Lexeme + "' of a record, use with to copy it with changes")
+	}
+	if i.Frozen {
+		return errors.New("Cannot set property '" + name.Lexeme + "' of a frozen instance")
+	}
+
 	i.Fields[name.Lexeme] = value
+	return nil
 }
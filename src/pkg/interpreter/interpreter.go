@@ -3,8 +3,8 @@ package interpreter
 import (
 	"errors"
 	"fmt"
-	"hash/fnv"
-	"strconv"
+	"math"
+	"slices"
 	"strings"
 
 	"github.com/hutcho66/glox/src/pkg/ast"
@@ -13,10 +13,17 @@ import (
 )
 
 type Interpreter struct {
-	errors      *lox_error.LoxErrors
-	globals     *Environment
-	environment *Environment
-	locals      map[ast.Expression]int
+	errors       *lox_error.LoxErrors
+	globals      *Environment
+	environment  *Environment
+	locals       locals
+	formatting   map[any]bool
+	frames       []*callFrame
+	callSite     *token.Token
+	maxCallDepth int
+	extensions   map[string]map[string]LoxCallable
+	deferred     []deferredCall
+	assertions   bool
 }
 
 func NewInterpreter(errors *lox_error.LoxErrors) *Interpreter {
@@ -31,18 +38,34 @@ func NewInterpreter(errors *lox_error.LoxErrors) *Interpreter {
 		errors:      errors,
 		globals:     globals,
 		environment: globals,
-		locals:      make(map[ast.Expression]int),
+		locals:      locals{},
+		formatting:  make(map[any]bool),
+
+		maxCallDepth: DefaultMaxCallDepth,
+		extensions:   make(map[string]map[string]LoxCallable),
+		assertions:   true,
 	}
 }
 
+// SetAssertions turns assert statements and the requires and ensures clauses of functions
+// on or off. When off their conditions aren't evaluated at all.
+func (i *Interpreter) SetAssertions(enabled bool) {
+	i.assertions = enabled
+}
+
 func (i *Interpreter) Interpret(statements []ast.Statement) (value any, ok bool) {
+	environment, locals := i.environment, i.locals
 	defer func() {
 		// catch any errors
 		if err := recover(); err != nil {
+			// an error can unwind from anywhere, so return to where the statements were run
+			i.environment, i.locals = environment, locals
+			i.callSite = nil
 			ok = false
 			return
 		}
 	}()
+	defer i.runDeferred(len(i.deferred))
 
 	for idx, s := range statements {
 		if len(statements) >= 1 && idx == len(statements)-1 {
@@ -63,7 +86,16 @@ func (i *Interpreter) Interpret(statements []ast.Statement) (value any, ok bool)
 }
 
 func (i *Interpreter) Resolve(expression ast.Expression, depth int) {
-	i.locals[expression] = depth
+	i.locals.Resolve(expression, depth)
+}
+
+// locals holds how many scopes out the variable used by each expression is declared, for
+// expressions that use a local variable. Source run by eval has its own locals, which are
+// kept by the functions it declares, so that they can be freed along with the source.
+type locals map[ast.Expression]int
+
+func (l locals) Resolve(expression ast.Expression, depth int) {
+	l[expression] = depth
 }
 
 func (i *Interpreter) execute(s ast.Statement) (ok bool) {
@@ -78,6 +110,9 @@ func (i *Interpreter) executeFinalExpressionStatement(s *ast.ExpressionStatement
 }
 
 func (i *Interpreter) executeBlock(s []ast.Statement, environment *Environment) {
+	// calls deferred in this block run however it exits, including by a panic
+	defer i.runDeferred(len(i.deferred))
+
 	previous := i.environment
 	i.environment = environment
 
@@ -115,8 +150,8 @@ func (i *Interpreter) VisitLoopStatement(s *ast.LoopStatement) {
 	// catch break statement
 	defer func() {
 		if val := recover(); val != nil {
-			if val != LoxBreak {
-				// repanic - not a break statement
+			if !isLoopControl(val, BREAK, s.Label) {
+				// repanic - not a break statement for this loop
 				panic(val)
 			}
 
@@ -129,8 +164,10 @@ func (i *Interpreter) VisitLoopStatement(s *ast.LoopStatement) {
 	for isTruthy(i.evaluate(s.Condition)) {
 		// this needs to be pushed to a function so that
 		// panic-defer works with continue statements
-		i.executeLoopBody(s.Body, s.Increment)
+		i.executeLoopBody(s.Body, s.Increment, s.Label, s.PerIteration)
 	}
+
+	i.environment = environment
 }
 
 func (i *Interpreter) VisitForEachStatement(s *ast.ForEachStatement) {
@@ -139,8 +176,8 @@ func (i *Interpreter) VisitForEachStatement(s *ast.ForEachStatement) {
 	// catch break statement
 	defer func() {
 		if val := recover(); val != nil {
-			if val != LoxBreak {
-				// repanic - not a break statement
+			if !isLoopControl(val, BREAK, s.Label) {
+				// repanic - not a break statement for this loop
 				panic(val)
 			}
 
@@ -150,48 +187,47 @@ func (i *Interpreter) VisitForEachStatement(s *ast.ForEachStatement) {
 		}
 	}()
 
-	// retrieve the array, it must exists in the outer scope
-	a := i.evaluate(s.Array)
-	array, ok := a.(LoxArray)
+	// retrieve the array or range, it must exists in the outer scope
+	next, ok := iterator(i.evaluate(s.Array))
 	if !ok {
-		panic(i.errors.RuntimeError(s.VariableName, "for-of loops are only valid on arrays"))
-	}
-	if len(array) == 0 {
-		return
+		panic(i.runtimeError(s.VariableName, "for-of loops are only valid on arrays and ranges"))
 	}
+	element, more := next()
 
-	// start a new scope and create the loop variable, initialized to first element of array
-	i.environment = NewEnclosingEnvironment(i.environment)
-	loop_position := 0
-	i.environment.define(s.VariableName.Lexeme, array[loop_position])
+	// loop through elements
+	for ; more; element, more = next() {
+		// each iteration has a new scope containing the loop variable, so
+		// closures created in the body capture that iteration's element
+		i.environment = NewEnclosingEnvironment(outerEnvironment)
+		i.environment.define(s.VariableName.Lexeme, element)
 
-	// loop through array
-	for {
 		// execute the loop
-		i.executeLoopBody(s.Body, nil)
-
-		// reassign loop variable to next element of array
-		loop_position += 1
-		if loop_position < len(array) {
-			i.environment.assign(s.VariableName, array[loop_position])
-		} else {
-			// exit loop, all done
-			break
-		}
+		i.executeLoopBody(s.Body, nil, s.Label, false)
 	}
 
 	// restore environment
 	i.environment = outerEnvironment
 }
 
-func (i *Interpreter) executeLoopBody(body ast.Statement, increment ast.Expression) {
+func (i *Interpreter) executeLoopBody(body ast.Statement, increment ast.Expression, label *token.Token, perIteration bool) {
 	environment := i.environment
 
+	// the loop variables are copied before the increment, so the closures
+	// created in this iteration don't see it
+	advance := func() {
+		if perIteration {
+			i.environment = i.environment.copy()
+		}
+		if increment != nil {
+			i.evaluate(increment)
+		}
+	}
+
 	// catch any continue statement - this will only end current loop iteration
 	defer func() {
 		if val := recover(); val != nil {
-			if val != LoxContinue {
-				// repanic - not a continue statement
+			if !isLoopControl(val, CONTINUE, label) {
+				// repanic - not a continue statement for this loop
 				panic(val)
 			}
 
@@ -200,16 +236,12 @@ func (i *Interpreter) executeLoopBody(body ast.Statement, increment ast.Expressi
 			i.environment = environment
 
 			// ensure increment is run after continue
-			if increment != nil {
-				i.evaluate(increment)
-			}
+			advance()
 		}
 	}()
 
 	i.execute(body)
-	if increment != nil {
-		i.evaluate(increment)
-	}
+	advance()
 }
 
 func (i *Interpreter) VisitVarStatement(s *ast.VarStatement) {
@@ -223,24 +255,113 @@ func (i *Interpreter) VisitVarStatement(s *ast.VarStatement) {
 }
 
 func (i *Interpreter) VisitFunctionStatement(s *ast.FunctionStatement) {
-	function := &LoxFunction{declaration: s, closure: i.environment}
-	i.environment.define(s.Name.Lexeme, function)
+	decorators := i.evaluateDecorators(s.Decorators)
+	function := &LoxFunction{declaration: s, closure: i.environment, locals: i.locals}
+	i.environment.define(s.Name.Lexeme, i.decorate(function, decorators, s.Name))
 }
 
-func (i *Interpreter) VisitClassStatement(s *ast.ClassStatement) {
-	var superclass *LoxClass = nil
-	if s.Superclass != nil {
-		value := i.evaluate(s.Superclass)
+func (i *Interpreter) evaluateDecorators(expressions []ast.Expression) []any {
+	decorators := []any{}
+	for _, expression := range expressions {
+		decorators = append(decorators, i.evaluate(expression))
+	}
+	return decorators
+}
 
-		var ok bool
-		superclass, ok = value.(*LoxClass)
-		if !ok {
-			panic(i.errors.RuntimeError(s.Superclass.Name, "Superclass must be a class."))
+// decorate applies decorators to a function or class, innermost (last) first
+func (i *Interpreter) decorate(value any, decorators []any, name *token.Token) any {
+	for d := len(decorators) - 1; d >= 0; d-- {
+		decorator := i.decorator(decorators[d], name)
+
+		var err error
+		value, err = decorator.Call(i, []any{value})
+		if err != nil {
+			panic(i.runtimeError(name, err.Error()))
 		}
 	}
+	return value
+}
+
+// decorator checks that a value can be used as a decorator
+func (i *Interpreter) decorator(value any, name *token.Token) LoxCallable {
+	decorator, ok := value.(LoxCallable)
+	if !ok {
+		panic(i.runtimeError(name, "Decorator must be a function or class"))
+	}
+	if decorator.Arity() != 1 {
+		panic(i.runtimeError(name, fmt.Sprintf("Decorator must take 1 argument but takes %d", decorator.Arity())))
+	}
+	return decorator
+}
+
+func (i *Interpreter) decorateMethod(method *LoxFunction, decorators []any) *LoxFunction {
+	name := method.declaration.Name
+	value := i.decorate(method, decorators, name)
+
+	wrapper, ok := value.(*LoxFunction)
+	if !ok {
+		panic(i.runtimeError(name, "Method decorator must return a function"))
+	}
+	if wrapper == method {
+		return method
+	}
+
+	kind := method.declaration.Kind
+	if kind == ast.GETTER_METHOD && wrapper.Arity() != 0 {
+		panic(i.runtimeError(name, "Decorated getter must take no arguments"))
+	}
+	if kind == ast.SETTER_METHOD && wrapper.Arity() != 1 {
+		panic(i.runtimeError(name, "Decorated setter must take 1 argument"))
+	}
+
+	// the wrapper takes on the identity of the method it replaces, so that it is
+	// bound and called like any other method
+	declaration := *wrapper.declaration
+	declaration.Name = name
+	declaration.Kind = kind
+	declaration.Doc = method.declaration.Doc
+	return &LoxFunction{declaration: &declaration, closure: wrapper.closure, locals: wrapper.locals, wraps: method}
+}
+
+func (i *Interpreter) VisitClassStatement(s *ast.ClassStatement) {
+	superclass := i.evaluateSuperclass(s)
+
+	// decorators are evaluated in the enclosing scope, before the class is defined
+	decorators := i.evaluateDecorators(s.Decorators)
+	methodDecorators := i.evaluateMethodDecorators(s)
 
 	i.environment.define(s.Name.Lexeme, nil)
+	class := i.buildClass(s, superclass, methodDecorators)
+	i.environment.assign(s.Name, i.decorate(class, decorators, s.Name))
+}
+
+func (i *Interpreter) evaluateSuperclass(s *ast.ClassStatement) *LoxClass {
+	if s.Superclass == nil {
+		return nil
+	}
+
+	superclass, ok := i.evaluate(s.Superclass).(*LoxClass)
+	if !ok {
+		panic(i.runtimeError(s.Superclass.Name, "Superclass must be a class."))
+	}
+	if superclass.Record {
+		// a subclass would need the fields, constructor and equality of the record
+		panic(i.runtimeError(s.Superclass.Name, "Records can't be subclassed."))
+	}
+	return superclass
+}
 
+func (i *Interpreter) evaluateMethodDecorators(s *ast.ClassStatement) map[*ast.FunctionStatement][]any {
+	methodDecorators := map[*ast.FunctionStatement][]any{}
+	for _, method := range s.Methods {
+		methodDecorators[method] = i.evaluateDecorators(method.Decorators)
+	}
+	return methodDecorators
+}
+
+// buildClass creates the class declared by a class statement, anonymous class or object literal,
+// with its methods closing over the current environment
+func (i *Interpreter) buildClass(s *ast.ClassStatement, superclass *LoxClass, methodDecorators map[*ast.FunctionStatement][]any) *LoxClass {
 	if superclass != nil {
 		i.environment = NewEnclosingEnvironment(i.environment)
 		i.environment.define("super", superclass)
@@ -248,20 +369,113 @@ func (i *Interpreter) VisitClassStatement(s *ast.ClassStatement) {
 
 	methods := map[string]*LoxFunction{}
 	for _, method := range s.Methods {
-		function := &LoxFunction{method, i.environment, method.Name.Lexeme == "init"}
+		function := &LoxFunction{declaration: method, closure: i.environment, locals: i.locals, isInitializer: method.Name.Lexeme == "init"}
+		if len(method.Decorators) > 0 {
+			function = i.decorateMethod(function, methodDecorators[method])
+		}
 		methods[method.Name.Lexeme] = function
 	}
 
-	class := &LoxClass{Name: s.Name.Lexeme, Methods: methods, Super: superclass}
+	class := &LoxClass{Name: s.Name.Lexeme, Methods: methods, Super: superclass, Doc: s.Doc}
+	if s.Record {
+		class.Record = true
+		for _, field := range s.Fields {
+			class.Fields = append(class.Fields, field.Name.Lexeme)
+		}
+	}
 
 	if superclass != nil {
 		i.environment = i.environment.enclosing
 	}
 
-	i.environment.assign(s.Name, class)
+	return class
+}
+
+// deferredCall is a call whose callee and arguments have been evaluated, waiting for its block to exit
+type deferredCall struct {
+	callee    any
+	arguments []any
+	site      *token.Token
+}
+
+func (i *Interpreter) VisitDeferStatement(s *ast.DeferStatement) {
+	callee := i.evaluate(s.Call.Callee)
+	arguments := i.evaluateArguments(s.Call.Arguments)
+	i.deferred = append(i.deferred, deferredCall{callee: callee, arguments: arguments, site: s.Call.ClosingParen})
+}
+
+func (i *Interpreter) VisitAssertStatement(s *ast.AssertStatement) {
+	if !i.assertions || isTruthy(i.evaluate(s.Condition)) {
+		return
+	}
+
+	var message string
+	switch s.Keyword.Lexeme {
+	case "requires":
+		message = "Precondition failed: " + s.Source
+	case "ensures":
+		message = "Postcondition failed: " + s.Source
+	default:
+		message = "Assertion failed: " + s.Source
+	}
+	if s.Message != nil {
+		message += " (" + i.printRepresentation(i.evaluate(s.Message)) + ")"
+	}
+
+	panic(i.runtimeError(s.Keyword, message))
+}
+
+// checkConditions checks the requires or ensures clauses of a function in the given environment
+func (i *Interpreter) checkConditions(conditions []*ast.AssertStatement, environment *Environment) {
+	previous := i.environment
+	i.environment = environment
+	for _, condition := range conditions {
+		i.execute(condition)
+	}
+	i.environment = previous
+}
+
+// runDeferred runs the calls deferred since there were depth pending calls, most recent first.
+// Each call is run by its own go defer, so the rest still run if one raises an error.
+func (i *Interpreter) runDeferred(depth int) {
+	if len(i.deferred) == depth {
+		return
+	}
+
+	calls := slices.Clone(i.deferred[depth:])
+	i.deferred = i.deferred[:depth]
+	for _, call := range calls {
+		defer i.call(call.callee, call.arguments, call.site)
+	}
 }
 
 func (i *Interpreter) VisitReturnStatement(s *ast.ReturnStatement) {
+	// the deferred calls and ensures clauses of this function must run after the returned call, and
+	// the method a decorator wrapper replaces is bound using the wrapper's frame, so in those cases
+	// the returned call can't be run in its place
+	frame := i.frames[len(i.frames)-1]
+	replaceable := len(i.deferred) == frame.deferred && !(i.assertions && len(frame.function.declaration.Ensures) > 0) && frame.function.wraps == nil
+	if s.TailCall && replaceable {
+		call := s.Value.(*ast.CallExpression)
+		callee := i.evaluate(call.Callee)
+		argValues := i.evaluateArguments(call.Arguments)
+
+		// Lox functions are run by the caller once this one has unwound,
+		// anything else is called as usual
+		if function, ok := callee.(*LoxFunction); ok {
+			// the frame the function is bound with is about to be replaced
+			function, err := i.bindWrapped(function)
+			if err != nil {
+				panic(i.runtimeError(call.ClosingParen, err.Error()))
+			}
+			if len(argValues) != function.Arity() {
+				panic(i.runtimeError(call.ClosingParen, fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(argValues))))
+			}
+			panic(LoxTailCall(function, argValues))
+		}
+		panic(LoxReturn(i.call(callee, argValues, call.ClosingParen)))
+	}
+
 	var value any = nil
 	if s.Value != nil {
 		value = i.evaluate(s.Value)
@@ -273,11 +487,17 @@ func (i *Interpreter) VisitReturnStatement(s *ast.ReturnStatement) {
 
 func (i *Interpreter) VisitBreakStatement(s *ast.BreakStatement) {
 	// Using panic to wind back call stack
+	if s.Label != nil {
+		panic(LoxLabeledBreak(s.Label.Lexeme))
+	}
 	panic(LoxBreak)
 }
 
 func (i *Interpreter) VisitContinueStatement(s *ast.ContinueStatement) {
 	// Using panic to wind back call stack
+	if s.Label != nil {
+		panic(LoxLabeledContinue(s.Label.Lexeme))
+	}
 	panic(LoxContinue)
 }
 
@@ -331,37 +551,117 @@ func (i *Interpreter) VisitSequenceExpression(e *ast.SequenceExpression) any {
 }
 
 func (i *Interpreter) VisitArrayExpression(e *ast.ArrayExpression) any {
-	// represent arrays by slices of any
-	array := make(LoxArray, len(e.Items))
-	for idx, item := range e.Items {
-		array[idx] = i.evaluate(item)
+	elements := make([]any, 0, len(e.Items))
+	for _, item := range e.Items {
+		spread, ok := item.(*ast.SpreadExpression)
+		if !ok {
+			elements = append(elements, i.evaluate(item))
+			continue
+		}
+
+		value := i.evaluate(spread.Expr)
+		next, ok := iterator(value)
+		if !ok {
+			panic(i.runtimeError(spread.Operator, "Only arrays and ranges can be spread into an array literal, not "+typeName(value)))
+		}
+		for element, more := next(); more; element, more = next() {
+			elements = append(elements, element)
+		}
 	}
 
-	return array
+	return NewLoxArray(elements)
 }
 
 func (i *Interpreter) VisitMapExpression(e *ast.MapExpression) any {
-	m := make(LoxMap, len(e.Keys))
+	m := NewLoxMap(make(map[int]MapPair, len(e.Keys)))
 	for idx := range e.Keys {
-		key, isString := i.evaluate(e.Keys[idx]).(string)
-		if !isString {
-			panic(i.errors.RuntimeError(e.OpeningBrace, "map keys must be strings"))
+		// later keys replace earlier ones, including those spread from another map
+		if spread, ok := e.Keys[idx].(*ast.SpreadExpression); ok {
+			value := i.evaluate(spread.Expr)
+			other, ok := value.(*LoxMap)
+			if !ok {
+				panic(i.runtimeError(spread.Operator, "Only maps can be spread into a map literal, not "+typeName(value)))
+			}
+			for hash, pair := range other.Pairs {
+				m.Pairs[hash] = pair
+			}
+			continue
 		}
-		hash := Hash(key)
+
+		key := i.evaluate(e.Keys[idx])
+		hash := i.hashKey(key, e.OpeningBrace)
 		value := i.evaluate(e.Values[idx])
 
-		m[hash] = MapPair{Key: key, Value: value}
+		m.Pairs[hash] = MapPair{Key: key, Value: value}
 	}
 
 	return m
 }
 
+func (i *Interpreter) VisitSpreadExpression(e *ast.SpreadExpression) any {
+	// the parser only allows spreads inside array and map literals, which expand them themselves
+	panic(i.runtimeError(e.Operator, "Can only spread values into array and map literals"))
+}
+
+func (i *Interpreter) VisitComprehensionExpression(e *ast.ComprehensionExpression) any {
+	enclosingEnvironment := i.environment
+	defer func() {
+		i.environment = enclosingEnvironment
+	}()
+
+	if e.Key == nil {
+		elements := []any{}
+		i.comprehend(e.Clauses, func() {
+			elements = append(elements, i.evaluate(e.Value))
+		})
+		return NewLoxArray(elements)
+	}
+
+	m := NewLoxMap(nil)
+	i.comprehend(e.Clauses, func() {
+		key := i.evaluate(e.Key)
+		m.Pairs[i.hashKey(key, e.Opening)] = MapPair{Key: key, Value: i.evaluate(e.Value)}
+	})
+	return m
+}
+
+// comprehend runs the remaining comprehension clauses, calling emit for every
+// combination of loop variables that passes all conditions
+func (i *Interpreter) comprehend(clauses []*ast.ComprehensionClause, emit func()) {
+	if len(clauses) == 0 {
+		emit()
+		return
+	}
+
+	clause := clauses[0]
+	if clause.Variable == nil {
+		if isTruthy(i.evaluate(clause.Condition)) {
+			i.comprehend(clauses[1:], emit)
+		}
+		return
+	}
+
+	next, ok := iterator(i.evaluate(clause.Iterable))
+	if !ok {
+		panic(i.runtimeError(clause.Variable, "for clauses in comprehensions are only valid on arrays and ranges"))
+	}
+
+	// each for clause has its own scope containing the loop variable
+	enclosingEnvironment := i.environment
+	for element, more := next(); more; element, more = next() {
+		i.environment = NewEnclosingEnvironment(enclosingEnvironment)
+		i.environment.define(clause.Variable.Lexeme, element)
+		i.comprehend(clauses[1:], emit)
+	}
+	i.environment = enclosingEnvironment
+}
+
 func (i *Interpreter) VisitGetExpression(e *ast.GetExpression) any {
 	object := i.evaluate(e.Object)
 	if instance, ok := object.(LoxObject); ok {
 		property, err := instance.get(e.Name)
 		if err != nil {
-			panic(i.errors.RuntimeError(e.Name, err.Error()))
+			panic(i.runtimeError(e.Name, err.Error()))
 		}
 
 		// if field is a getter method, call it immediately
@@ -369,7 +669,7 @@ func (i *Interpreter) VisitGetExpression(e *ast.GetExpression) any {
 			if method.declaration.Kind == ast.GETTER_METHOD {
 				value, err := method.Call(i, []any{})
 				if err != nil {
-					panic(i.errors.RuntimeError(e.Name, err.Error()))
+					panic(i.runtimeError(e.Name, err.Error()))
 				}
 
 				return value
@@ -380,7 +680,12 @@ func (i *Interpreter) VisitGetExpression(e *ast.GetExpression) any {
 		return property
 	}
 
-	panic(i.errors.RuntimeError(e.Name, "Only instances have properties."))
+	// other values only have the methods of their type
+	method, err := i.method(object, e.Name)
+	if err != nil {
+		panic(i.runtimeError(e.Name, err.Error()))
+	}
+	return method
 }
 
 func (i *Interpreter) VisitSetExpression(e *ast.SetExpression) any {
@@ -395,17 +700,17 @@ func (i *Interpreter) VisitSetExpression(e *ast.SetExpression) any {
 			boundMethod := method.bind(instance)
 			_, err := boundMethod.Call(i, []any{value})
 			if err != nil {
-				panic(i.errors.RuntimeError(e.Name, err.Error()))
+				panic(i.runtimeError(e.Name, err.Error()))
 			}
 
-		} else {
-			instance.set(e.Name, value)
+		} else if err := instance.set(e.Name, value); err != nil {
+			panic(i.runtimeError(e.Name, err.Error()))
 		}
 
 		return value
 	}
 
-	panic(i.errors.RuntimeError(e.Name, "Can only set fields on instances."))
+	panic(i.runtimeError(e.Name, "Can only set fields on instances."))
 }
 
 func (i *Interpreter) VisitThisExpression(e *ast.ThisExpression) any {
@@ -420,7 +725,7 @@ func (i *Interpreter) VisitSuperGetExpression(e *ast.SuperGetExpression) any {
 	method := sc.findMethod(e.Method.Lexeme)
 
 	if method == nil {
-		panic(i.errors.RuntimeError(e.Method, "Undefined property '"+e.Method.Lexeme+"'."))
+		panic(i.runtimeError(e.Method, "Undefined property '"+e.Method.Lexeme+"'."))
 	}
 
 	// if field is a getter method, call it immediately
@@ -428,7 +733,7 @@ func (i *Interpreter) VisitSuperGetExpression(e *ast.SuperGetExpression) any {
 		boundMethod := method.bind(object)
 		value, err := boundMethod.Call(i, []any{})
 		if err != nil {
-			panic(i.errors.RuntimeError(e.Keyword, err.Error()))
+			panic(i.runtimeError(e.Keyword, err.Error()))
 		}
 
 		return value
@@ -445,7 +750,7 @@ func (i *Interpreter) VisitSuperSetExpression(e *ast.SuperSetExpression) any {
 	method := sc.findMethod(e.Method.Lexeme)
 
 	if method == nil {
-		panic(i.errors.RuntimeError(e.Method, "Undefined setter '"+e.Method.Lexeme+"'."))
+		panic(i.runtimeError(e.Method, "Undefined setter '"+e.Method.Lexeme+"'."))
 	}
 
 	// the only case where it makes sense to use a super set expression
@@ -455,138 +760,274 @@ func (i *Interpreter) VisitSuperSetExpression(e *ast.SuperSetExpression) any {
 		boundMethod := method.bind(object)
 		value, err := boundMethod.Call(i, []any{value})
 		if err != nil {
-			panic(i.errors.RuntimeError(e.Keyword, err.Error()))
+			panic(i.runtimeError(e.Keyword, err.Error()))
 		}
 
 		return value
 	}
 
-	panic(i.errors.RuntimeError(e.Keyword, "Method is not a setter"))
+	panic(i.runtimeError(e.Keyword, "Method is not a setter"))
 }
 
-func (i *Interpreter) arrayIndexExpression(e *ast.IndexExpression) any {
-	object := i.evaluate(e.Object)
-	leftIndex, leftIsNumber := i.evaluate(e.LeftIndex).(float64)
-	var (
-		rightIndex    float64
-		rightIsNumber bool = false
-	)
+func (i *Interpreter) arrayIndexExpression(e *ast.IndexExpression, object any) any {
+	length := 0
+	switch val := object.(type) {
+	case *LoxArray:
+		length = len(val.Elements)
+	case string:
+		length = len(val)
+	}
+
+	if e.Slice {
+		return elementsAt(object, i.sliceIndices(e, length))
+	}
+
+	index := i.evaluate(e.LeftIndex)
+	if r, ok := index.(LoxRange); ok {
+		// a range selects each element at the indices it contains
+		indices := []int{}
+		next, _ := iterator(r)
+		for value, more := next(); more; value, more = next() {
+			indices = append(indices, i.elementIndex(value, length, e.ClosingBracket))
+		}
+		return elementsAt(object, indices)
+	}
+
+	position := i.elementIndex(index, length, e.ClosingBracket)
+	switch val := object.(type) {
+	case *LoxArray:
+		return val.Elements[position]
+	case string:
+		return string(val[position]) // go will return a byte
+	default:
+		panic(i.runtimeError(e.ClosingBracket, "Unreachable"))
+	}
+}
+
+// elementIndex converts an index value to a position in an array or string of the given length,
+// negative indices count back from the end
+func (i *Interpreter) elementIndex(index any, length int, closingBracket *token.Token) int {
+	position := i.integerIndex(index, closingBracket)
+	if position < 0 {
+		position += length
+	}
+	if position < 0 || position >= length {
+		panic(i.runtimeError(closingBracket, "Index is out of range"))
+	}
+	return position
+}
+
+func (i *Interpreter) integerIndex(index any, closingBracket *token.Token) int {
+	value, isNumber := index.(float64)
+	if !isNumber || !isInteger(value) {
+		panic(i.runtimeError(closingBracket, "Index must be integer"))
+	}
+	return int(value)
+}
+
+// sliceIndices returns the positions selected by a slice, following python's rules:
+// negative indices count back from the end, and out of range indices are clamped
+func (i *Interpreter) sliceIndices(e *ast.IndexExpression, length int) []int {
+	step := 1
+	if e.Step != nil {
+		step = i.integerIndex(i.evaluate(e.Step), e.ClosingBracket)
+		if step == 0 {
+			panic(i.runtimeError(e.ClosingBracket, "Slice step cannot be zero"))
+		}
+	}
+
+	// when stepping backwards, the default slice is from the last element to before the first
+	start, stop := 0, length
+	if step < 0 {
+		start, stop = length-1, -1
+	}
+	if e.LeftIndex != nil {
+		start = clampIndex(i.integerIndex(i.evaluate(e.LeftIndex), e.ClosingBracket), length, step)
+	}
 	if e.RightIndex != nil {
-		rightIndex, rightIsNumber = i.evaluate(e.RightIndex).(float64)
+		stop = clampIndex(i.integerIndex(i.evaluate(e.RightIndex), e.ClosingBracket), length, step)
 	}
 
-	if !leftIsNumber || !isInteger(leftIndex) {
-		panic(i.errors.RuntimeError(e.ClosingBracket, "Index must be integer"))
+	indices := []int{}
+	for position := start; (step > 0 && position < stop) || (step < 0 && position > stop); position += step {
+		indices = append(indices, position)
 	}
+	return indices
+}
 
-	if rightIsNumber && (!rightIsNumber || !isInteger(rightIndex)) {
-		panic(i.errors.RuntimeError(e.ClosingBracket, "Index must be integer"))
+func clampIndex(index, length, step int) int {
+	if index < 0 {
+		index += length
 	}
 
+	lower, upper := 0, length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+	return max(lower, min(index, upper))
+}
+
+// elementsAt returns a new array or string made of the elements at the given positions
+func elementsAt(object any, indices []int) any {
 	switch val := object.(type) {
-	case LoxArray:
-		{
-			if leftIndex < 0 || int(leftIndex) >= len(val) ||
-				(rightIsNumber && (rightIndex < 0 || int(rightIndex) > len(val))) {
-				panic(i.errors.RuntimeError(e.ClosingBracket, "Index is out of range"))
-			}
-			if rightIsNumber && (leftIndex > rightIndex) {
-				panic(i.errors.RuntimeError(e.ClosingBracket, "Right index of slice must be greater or equal to left index"))
-			}
-			if rightIsNumber {
-				return val[int(leftIndex):int(rightIndex)]
-			} else {
-				return val[int(leftIndex)]
-			}
+	case *LoxArray:
+		result := make([]any, len(indices))
+		for i, position := range indices {
+			result[i] = val.Elements[position]
 		}
+		return NewLoxArray(result)
 	case string:
-		{
-			if leftIndex < 0 || int(leftIndex) >= len(val) ||
-				(rightIsNumber && (rightIndex < 0 || int(rightIndex) > len(val))) {
-				panic(i.errors.RuntimeError(e.ClosingBracket, "Index is out of range"))
-			}
-			if rightIsNumber && (leftIndex > rightIndex) {
-				panic(i.errors.RuntimeError(e.ClosingBracket, "Right index of slice must be greater or equal to left index"))
-			}
-			if rightIsNumber {
-				return val[int(leftIndex):int(rightIndex)]
-			} else {
-				return string(val[int(leftIndex)]) // go will return a byte
-			}
+		result := make([]byte, len(indices))
+		for i, position := range indices {
+			result[i] = val[position]
 		}
-	default:
-		panic(i.errors.RuntimeError(e.ClosingBracket, "Unreachable"))
+		return string(result)
 	}
+	return nil
 }
 
-func (i *Interpreter) mapIndexExpression(e *ast.IndexExpression) any {
-	object := i.evaluate(e.Object).(LoxMap)
-	key, isString := i.evaluate(e.LeftIndex).(string)
+func (i *Interpreter) mapIndexExpression(e *ast.IndexExpression, object *LoxMap) any {
+	if e.Slice {
+		panic(i.runtimeError(e.ClosingBracket, "Cannot slice maps"))
+	}
 
-	if e.RightIndex != nil {
-		panic(i.errors.RuntimeError(e.ClosingBracket, "Cannot slice maps"))
+	pair, _ := i.lookup(object, i.evaluate(e.LeftIndex))
+	return pair.Value
+}
+
+// hashKey checks that a value can be used as a map key, which requires that it can't change, and returns its hash
+func (i *Interpreter) hashKey(key any, t *token.Token) int {
+	if !isImmutable(key, map[any]bool{}) {
+		panic(i.runtimeError(t, fmt.Sprintf("map keys must be immutable, freeze the %s to use it as a key", typeName(key))))
+	}
+	hash, err := i.hash(key)
+	if err != nil {
+		panic(i.runtimeError(t, err.Error()))
 	}
+	return hash
+}
+
+// lookup finds the entry for a key in a map. A value that can't be used as a key can't be in
+// the map, so it is treated as absent rather than raising an error.
+func (i *Interpreter) lookup(m *LoxMap, key any) (MapPair, bool) {
+	if !isImmutable(key, map[any]bool{}) {
+		return MapPair{}, false
+	}
+	hash, err := i.hash(key)
+	if err != nil {
+		return MapPair{}, false
+	}
+	pair, ok := m.Pairs[hash]
+	return pair, ok
+}
 
-	if !isString {
-		panic(i.errors.RuntimeError(e.ClosingBracket, "Maps can only be indexed with strings"))
+func (i *Interpreter) VisitRangeExpression(e *ast.RangeExpression) any {
+	start, startIsNumber := i.evaluate(e.Start).(float64)
+	end, endIsNumber := i.evaluate(e.End).(float64)
+	if !startIsNumber || !endIsNumber {
+		panic(i.runtimeError(e.Operator, "Range bounds must be numbers"))
 	}
 
-	hash := Hash(key)
+	step := 1.0
+	if e.Step != nil {
+		var stepIsNumber bool
+		step, stepIsNumber = i.evaluate(e.Step).(float64)
+		if !stepIsNumber {
+			panic(i.runtimeError(e.Operator, "Range step must be a number"))
+		}
+		if step == 0 {
+			panic(i.runtimeError(e.Operator, "Range step cannot be zero"))
+		}
+	}
 
-	return object[hash].Value
+	return LoxRange{Start: start, End: end, Step: step, Inclusive: e.Inclusive}
 }
 
 func (i *Interpreter) VisitIndexExpression(e *ast.IndexExpression) any {
 	object := i.evaluate(e.Object)
-	switch object.(type) {
-	case LoxArray, string:
-		return i.arrayIndexExpression(e)
-	case LoxMap:
-		return i.mapIndexExpression(e)
+	switch val := object.(type) {
+	case *LoxArray, string:
+		return i.arrayIndexExpression(e, object)
+	case *LoxMap:
+		return i.mapIndexExpression(e, val)
 	}
-	panic(i.errors.RuntimeError(e.ClosingBracket, "Can only index arrays, strings and maps"))
+	panic(i.runtimeError(e.ClosingBracket, "Can only index arrays, strings and maps"))
 }
 
-func (i *Interpreter) arrayIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression) any {
-	array, _ := i.evaluate(e.Left.Object).(LoxArray)
-	index, isNumber := i.evaluate(e.Left.LeftIndex).(float64)
-
-	// don't need to check for right index as using a slice for assignment is a parser error
-	if !isNumber || !isInteger(index) {
-		panic(i.errors.RuntimeError(e.Left.ClosingBracket, "Index must be integer"))
+func (i *Interpreter) arrayIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression, array *LoxArray) any {
+	if array.Frozen {
+		panic(i.runtimeError(e.Left.ClosingBracket, "Cannot modify a frozen array"))
 	}
-	if index < 0 || int(index) >= len(array) {
-		panic(i.errors.RuntimeError(e.Left.ClosingBracket, "Index is out of range for array"))
+
+	if e.Left.Slice {
+		return i.arraySliceAssignment(e, array)
 	}
 
+	index := i.elementIndex(i.evaluate(e.Left.LeftIndex), len(array.Elements), e.Left.ClosingBracket)
+
 	value := i.evaluate(e.Value)
-	array[int(index)] = value
+	array.Elements[index] = value
 	return value
 }
 
-func (i *Interpreter) mapIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression) any {
-	m, _ := i.evaluate(e.Left.Object).(LoxMap)
-	key, isString := i.evaluate(e.Left.LeftIndex).(string)
+// arraySliceAssignment replaces the elements selected by a slice with the elements of another array.
+// A slice without a step can be replaced by any number of elements, growing or shrinking the array,
+// but a stepped slice must be replaced by the same number of elements.
+func (i *Interpreter) arraySliceAssignment(e *ast.IndexedAssignmentExpression, array *LoxArray) any {
+	indices := i.sliceIndices(e.Left, len(array.Elements))
+
+	value := i.evaluate(e.Value)
+	replacement, isArray := value.(*LoxArray)
+	if !isArray {
+		panic(i.runtimeError(e.Left.ClosingBracket, "Can only assign an array to a slice"))
+	}
+	// copy first, in case the replacement is the array being assigned to
+	elements := slices.Clone(replacement.Elements)
+
+	if e.Left.Step != nil {
+		if len(elements) != len(indices) {
+			panic(i.runtimeError(e.Left.ClosingBracket, fmt.Sprintf("Cannot assign %d elements to a stepped slice of %d elements", len(elements), len(indices))))
+		}
+		for idx, position := range indices {
+			array.Elements[position] = elements[idx]
+		}
+		return value
+	}
+
+	// the replacement goes at the start of the slice, even if the slice is empty
+	start := 0
+	if e.Left.LeftIndex != nil {
+		start = clampIndex(i.integerIndex(i.evaluate(e.Left.LeftIndex), e.Left.ClosingBracket), len(array.Elements), 1)
+	}
+
+	array.Elements = slices.Replace(array.Elements, start, start+len(indices), elements...)
+	return value
+}
 
-	if !isString {
-		panic(i.errors.RuntimeError(e.Left.ClosingBracket, "map keys must be strings"))
+func (i *Interpreter) mapIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression, m *LoxMap) any {
+	if m.Frozen {
+		panic(i.runtimeError(e.Left.ClosingBracket, "Cannot modify a frozen map"))
 	}
 
-	hash := Hash(key)
+	key := i.evaluate(e.Left.LeftIndex)
+	hash := i.hashKey(key, e.Left.ClosingBracket)
 	value := i.evaluate(e.Value)
-	m[hash] = MapPair{Key: key, Value: value}
+	m.Pairs[hash] = MapPair{Key: key, Value: value}
 	return value
 }
 
 func (i *Interpreter) VisitIndexedAssignmentExpression(e *ast.IndexedAssignmentExpression) any {
 	object := i.evaluate(e.Left.Object)
-	switch object.(type) {
-	case LoxArray:
-		return i.arrayIndexedAssignmentExpression(e)
-	case LoxMap:
-		return i.mapIndexedAssignmentExpression(e)
+	switch val := object.(type) {
+	case *LoxArray:
+		return i.arrayIndexedAssignmentExpression(e, val)
+	case *LoxMap:
+		if e.Left.Slice {
+			panic(i.runtimeError(e.Left.ClosingBracket, "Cannot slice maps"))
+		}
+		return i.mapIndexedAssignmentExpression(e, val)
 	}
-	panic(i.errors.RuntimeError(e.Left.ClosingBracket, "Can only assign to arrays and maps"))
+	panic(i.runtimeError(e.Left.ClosingBracket, "Can only assign to arrays and maps"))
 }
 
 func (i *Interpreter) VisitLogicalExpression(le *ast.LogicalExpression) any {
@@ -617,12 +1058,12 @@ func (i *Interpreter) VisitUnaryExpression(ue *ast.UnaryExpression) any {
 			if r, ok := right.(float64); ok {
 				return -r
 			}
-			panic(i.errors.RuntimeError(operator, "Operand must be a number"))
+			panic(i.runtimeError(operator, "Operand must be a number"))
 		}
 	}
 
 	// Unreachable
-	panic(i.errors.RuntimeError(operator, "Unreachable"))
+	panic(i.runtimeError(operator, "Unreachable"))
 }
 
 func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
@@ -633,9 +1074,16 @@ func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
 	switch operator.Type {
 	// can compare any type with == or != and don't need to type check
 	case token.EQUAL_EQUAL:
-		return left == right
+		return i.isEqual(left, right)
 	case token.BANG_EQUAL:
-		return left != right
+		return !i.isEqual(left, right)
+	// comparisons are valid for any values that can be ordered
+	case token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+		return i.comparison(operator, left, right)
+	case token.IN:
+		return i.contains(operator, right, left)
+	case token.NOT_IN:
+		return !i.contains(operator, right, left)
 	// concatenate can be used on any basic types as long as one or more is a string
 	case token.PLUS:
 		{
@@ -645,10 +1093,11 @@ func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
 				return leftNum + rightNum
 			}
 
-			leftArr, leftIsArray := left.(LoxArray)
-			rightArr, rightIsArray := right.(LoxArray)
+			// concatenating always creates a new array, never sharing storage with either operand
+			leftArr, leftIsArray := left.(*LoxArray)
+			rightArr, rightIsArray := right.(*LoxArray)
 			if leftIsArray && rightIsArray {
-				return append(leftArr, rightArr...)
+				return NewLoxArray(append(slices.Clone(leftArr.Elements), rightArr.Elements...))
 			}
 
 			leftStr, leftIsString := left.(string)
@@ -656,19 +1105,19 @@ func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
 			if leftIsString && rightIsString {
 				return leftStr + rightStr
 			} else if leftIsString {
-				if s, err := concatenate(operator, leftStr, right, false); err == nil {
+				if s, err := i.concatenate(operator, leftStr, right, false); err == nil {
 					return s
 				} else {
-					panic(i.errors.RuntimeError(operator, err.Error()))
+					panic(i.runtimeError(operator, err.Error()))
 				}
 			} else if rightIsString {
-				if s, err := concatenate(operator, rightStr, left, true); err == nil {
+				if s, err := i.concatenate(operator, rightStr, left, true); err == nil {
 					return s
 				} else {
-					panic(i.errors.RuntimeError(operator, err.Error()))
+					panic(i.runtimeError(operator, err.Error()))
 				}
 			} else {
-				panic(i.errors.RuntimeError(operator, "only valid for two numbers, two strings, two arrays, or one string and a number or boolean"))
+				panic(i.runtimeError(operator, "only valid for two numbers, two strings, two arrays, or one string and a number or boolean"))
 			}
 		}
 	// all other binary operations are only valid on numbers
@@ -677,7 +1126,7 @@ func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
 			l, lok := left.(float64)
 			r, rok := right.(float64)
 			if !lok || !rok {
-				panic(i.errors.RuntimeError(operator, "only valid for numbers"))
+				panic(i.runtimeError(operator, "only valid for numbers"))
 			}
 			switch operator.Type {
 			case token.MINUS:
@@ -686,45 +1135,162 @@ func (i *Interpreter) VisitBinaryExpression(be *ast.BinaryExpression) any {
 				return l / r
 			case token.STAR:
 				return l * r
-			case token.GREATER:
-				return l > r
-			case token.GREATER_EQUAL:
-				return l >= r
-			case token.LESS:
-				return l < r
-			case token.LESS_EQUAL:
-				return l <= r
 			}
 		}
 	}
 
 	// Unreachable
-	panic(i.errors.RuntimeError(operator, "Unreachable"))
+	panic(i.runtimeError(operator, "Unreachable"))
+}
+
+func (i *Interpreter) comparison(operator *token.Token, left, right any) bool {
+	// numbers are compared directly so that comparisons with NaN are always false
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if lok && rok {
+		switch operator.Type {
+		case token.GREATER:
+			return l > r
+		case token.GREATER_EQUAL:
+			return l >= r
+		case token.LESS:
+			return l < r
+		default:
+			return l <= r
+		}
+	}
+
+	order, err := i.compare(left, right)
+	if err != nil {
+		panic(i.runtimeError(operator, "only valid for two numbers, two strings or two arrays"))
+	}
+
+	switch operator.Type {
+	case token.GREATER:
+		return order > 0
+	case token.GREATER_EQUAL:
+		return order >= 0
+	case token.LESS:
+		return order < 0
+	default:
+		return order <= 0
+	}
+}
+
+// contains is the in operator, which tests for an element of an array or range, a key of a map,
+// a substring of a string, or whatever an instance's contains method decides
+func (i *Interpreter) contains(operator *token.Token, collection, value any) bool {
+	switch c := collection.(type) {
+	case *LoxArray:
+		return slices.ContainsFunc(c.Elements, func(element any) bool {
+			return i.isEqual(element, value)
+		})
+	case *LoxMap:
+		_, ok := i.lookup(c, value)
+		return ok
+	case LoxRange:
+		n, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		// only the numbers the range steps through are in it
+		steps := math.Round((n - c.Start) / c.Step)
+		return steps >= 0 && c.Start+steps*c.Step == n && c.includes(n)
+	case string:
+		substring, ok := value.(string)
+		if !ok {
+			panic(i.runtimeError(operator, "Only a string can be searched for in a string"))
+		}
+		return strings.Contains(c, substring)
+	case *LoxInstance:
+		method := c.Class.findMethod("contains")
+		if method == nil || method.declaration.Kind != ast.NORMAL_METHOD || method.Arity() != 1 {
+			break
+		}
+		result, err := method.bind(c).Call(i, []any{value})
+		if err != nil {
+			panic(i.runtimeError(operator, err.Error()))
+		}
+		return isTruthy(result)
+	}
+
+	panic(i.runtimeError(operator, "only valid for arrays, maps, ranges, strings and instances with a contains method"))
 }
 
 func (i *Interpreter) VisitLambdaExpression(e *ast.LambdaExpression) any {
-	return &LoxFunction{declaration: e.Function, closure: i.environment}
+	return &LoxFunction{declaration: e.Function, closure: i.environment, locals: i.locals}
+}
+
+func (i *Interpreter) VisitClassExpression(e *ast.ClassExpression) any {
+	superclass := i.evaluateSuperclass(e.Class)
+	return i.buildClass(e.Class, superclass, i.evaluateMethodDecorators(e.Class))
+}
+
+func (i *Interpreter) VisitObjectExpression(e *ast.ObjectExpression) any {
+	values := make([]any, len(e.Values))
+	for idx, value := range e.Values {
+		values[idx] = i.evaluate(value)
+	}
+
+	class := i.buildClass(e.Class, nil, i.evaluateMethodDecorators(e.Class))
+	instance := NewLoxInstance(class)
+	for idx, field := range e.Fields {
+		instance.Fields[field.Lexeme] = values[idx]
+	}
+	return instance
 }
 
 func (i *Interpreter) VisitCallExpression(e *ast.CallExpression) any {
 	callee := i.evaluate(e.Callee)
-	argValues := LoxArray{}
-	for _, argExpr := range e.Arguments {
+	argValues := i.evaluateArguments(e.Arguments)
+
+	return i.call(callee, argValues, e.ClosingParen)
+}
+
+func (i *Interpreter) evaluateArguments(arguments []ast.Expression) []any {
+	argValues := []any{}
+	for _, argExpr := range arguments {
 		argValues = append(argValues, i.evaluate(argExpr))
 	}
+	return argValues
+}
 
+func (i *Interpreter) VisitPipelineExpression(e *ast.PipelineExpression) any {
+	left := i.evaluate(e.Left)
+	callee := i.evaluate(e.Callee)
+	argValues := []any{}
+	for _, argExpr := range e.Arguments {
+		if argExpr == nil {
+			argValues = append(argValues, left)
+		} else {
+			argValues = append(argValues, i.evaluate(argExpr))
+		}
+	}
+
+	return i.call(callee, argValues, e.Operator)
+}
+
+// call calls a function or class, reporting any errors at the given token
+func (i *Interpreter) call(callee any, argValues []any, t *token.Token) any {
 	if function, ok := callee.(LoxCallable); ok {
 		if len(argValues) != function.Arity() {
-			panic(i.errors.RuntimeError(e.ClosingParen, fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(argValues))))
+			panic(i.runtimeError(t, fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(argValues))))
 		}
+		// record where the call was made for stack traces
+		enclosingCallSite := i.callSite
+		i.callSite = t
+		defer func() {
+			i.callSite = enclosingCallSite
+		}()
+
 		value, err := function.Call(i, argValues)
 		if err != nil {
-			panic(i.errors.RuntimeError(e.ClosingParen, err.Error()))
+			panic(i.runtimeError(t, err.Error()))
 		}
 
 		return value
 	}
-	panic(i.errors.RuntimeError(e.ClosingParen, "Can only call functions and classes"))
+	panic(i.runtimeError(t, "Can only call functions and classes"))
 }
 
 func (i *Interpreter) lookupVariable(name *token.Token, expression ast.Expression) any {
@@ -734,17 +1300,22 @@ func (i *Interpreter) lookupVariable(name *token.Token, expression ast.Expressio
 	} else {
 		val, ok := i.globals.get(name)
 		if !ok {
-			i.errors.RuntimeError(name, "Undefined variable '"+name.Lexeme+"'")
+			i.runtimeError(name, "Undefined variable '"+name.Lexeme+"'")
 		}
 		return val
 	}
 }
 
-func concatenate(operator *token.Token, stringValue string, otherValue any, reverse bool) (string, error) {
+func (i *Interpreter) concatenate(operator *token.Token, stringValue string, otherValue any, reverse bool) (string, error) {
 	var other string
-	switch otherValue.(type) {
+	switch v := otherValue.(type) {
 	case float64, bool:
 		other = Representation(otherValue)
+	case *LoxInstance:
+		if toStringMethod(v) == nil {
+			return "", errors.New(fmt.Sprintf("cannot concatenate string with type %s", Representation(otherValue)))
+		}
+		other = i.representation(v)
 	default:
 		return "", errors.New(fmt.Sprintf("cannot concatenate string with type %s", Representation(otherValue)))
 	}
@@ -768,57 +1339,3 @@ func isTruthy(value any) bool {
 	}
 	return true
 }
-
-func Representation(v any) string {
-	switch v := v.(type) {
-	case nil:
-		return "nil"
-	case string:
-		return fmt.Sprintf("\"%s\"", v)
-	case bool:
-		return fmt.Sprintf("%t", v)
-	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
-	case LoxArray:
-		{
-			itemStrings := make([]string, len(v))
-			for i, item := range v {
-				itemStrings[i] = Representation(item)
-			}
-			return "[" + strings.Join(itemStrings, ", ") + "]"
-		}
-	case LoxMap:
-		return "<map>"
-	case *LoxFunction:
-		if v.declaration.Name != nil {
-			return "<fn " + v.declaration.Name.Lexeme + ">"
-		} else {
-			return "<lambda>"
-		}
-	case *LoxClass:
-		return "<class " + v.Name + ">"
-	case *LoxInstance:
-		return "<object " + v.Class.Name + ">"
-	case LoxNative:
-		return "<native fn " + v.Name() + ">"
-	}
-
-	return "<object>"
-}
-
-func PrintRepresentation(v any) string {
-	switch v := v.(type) {
-	case string:
-		return fmt.Sprint(v)
-	case nil, bool, float64, LoxArray, LoxCallable, LoxMap:
-		return Representation(v)
-	}
-
-	return "<object>"
-}
-
-func Hash(v string) int {
-	h := fnv.New64a()
-	h.Write([]byte(v))
-	return int(h.Sum64())
-}
@@ -2,10 +2,13 @@ package interpreter_test
 
 import (
 	"io"
+	"math"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/hutcho66/glox/src/pkg/ast"
+	"github.com/hutcho66/glox/src/pkg/checker"
 	"github.com/hutcho66/glox/src/pkg/interpreter"
 	"github.com/hutcho66/glox/src/pkg/lox_error"
 	"github.com/hutcho66/glox/src/pkg/parser"
@@ -23,9 +26,29 @@ func TestInterpreter(t *testing.T) {
 		// ignore whitespace
 		{"whitespace", "   \t\r 5", 5.0},
 
+		// number literals
+		{"hex literal", "0xFF", 255.0},
+		{"hex literal lowercase", "0xdead_beef", 3735928559.0},
+		{"octal literal", "0o17", 15.0},
+		{"binary literal", "0B1010", 10.0},
+		{"large hex literal", "0x1_0000_0000_0000_0000", 18446744073709551616.0},
+		{"digit separators", "1_000_000.000_1", 1000000.0001},
+		{"exponent", "1e-9", 1e-9},
+		{"exponent with sign and fraction", "2.5E+3", 2500.0},
+		{"trailing decimal point", "1.", 1.0},
+		{"e after number is a name", "extend(\"number\", \"e\", n => n)\n 2.e()", 2.0},
+		{"infinity", "Infinity", math.Inf(1)},
+		{"negative infinity", "-Infinity < -1e308", true},
+		{"nan is not equal to itself", "NaN == NaN", false},
+		{"nan type", "type(NaN)", "number"},
+
 		// ignore comments
 		{"comment", `5 // comment`, 5.0},
 		{"comment - newline", "// comment\n5", 5.0},
+		{"block comment", "5 /* comment */ + 1", 6.0},
+		{"block comment - multiline", "/* line one\n line two */\n5", 5.0},
+		{"block comment - nested", "/* outer /* inner */ still outer */ 5", 5.0},
+		{"doc comment", "/// doc comment\nvar x = 5; x", 5.0},
 
 		// basic literals
 		{"nil literal", "nil", nil},
@@ -38,11 +61,11 @@ func TestInterpreter(t *testing.T) {
 world"`, "hello\nworld"},
 
 		// array literal
-		{"array literal", "[5, true]", interpreter.LoxArray{5.0, true}},
+		{"array literal", "[5, true]", interpreter.NewLoxArray([]any{5.0, true})},
 
 		// map literal
-		{"map literal", `{"foo": "bar"}`, interpreter.LoxMap{interpreter.Hash("foo"): interpreter.MapPair{"foo", "bar"}}},
-		{"empty map literal", `{}`, interpreter.LoxMap{}},
+		{"map literal", `{"foo": "bar"}`, interpreter.NewLoxMap(map[int]interpreter.MapPair{interpreter.Hash("foo"): {"foo", "bar"}})},
+		{"empty map literal", `{}`, interpreter.NewLoxMap(nil)},
 
 		// lambda literal
 		{"lambda literal", "() => {}", &interpreter.LoxFunction{}},
@@ -82,7 +105,7 @@ world"`, "hello\nworld"},
 		{"string concatenation with boolean", `"x: " + true`, "x: true"},
 
 		// array concatenate
-		{"array concat", "[5] + [true]", interpreter.LoxArray{5.0, true}},
+		{"array concat", "[5] + [true]", interpreter.NewLoxArray([]any{5.0, true})},
 
 		// logical expressions
 		{"logical and - returns right if left is true", "true and 5.0", 5.0},
@@ -105,12 +128,100 @@ world"`, "hello\nworld"},
 
 		// indexing
 		{"array index get", "var x = [1, 2, 3]; x[1]", 2.0},
-		{"array index slice", "var x = [1, 2, 3]; x[1:3]", interpreter.LoxArray{2.0, 3.0}},
+		{"array index slice", "var x = [1, 2, 3]; x[1:3]", interpreter.NewLoxArray([]any{2.0, 3.0})},
 		{"array index assign", "var x = [1, 2, 3]; x[1] = 5; x[1]", 5.0},
 		{"map index get", `var x = {"foo": "bar"}; x["foo"]`, "bar"},
 		{"array index assign", `var x = {"foo": "bar"}; x["foo"] = "baz"; x["foo"]`, "baz"},
 		{"string index get", `var x = "hello"; x[1]`, "e"},
 		{"string index slice", `var x = "hello"; x[1:5]`, "ello"},
+		{"negative index", "var x = [1, 2, 3]; x[-1]", 3.0},
+		{"negative index assign", "var x = [1, 2, 3]; x[-1] = 5; x", interpreter.NewLoxArray([]any{1.0, 2.0, 5.0})},
+		{"slice - open end", "var x = [1, 2, 3, 4]; x[-3:]", interpreter.NewLoxArray([]any{2.0, 3.0, 4.0})},
+		{"slice - open start", "var x = [1, 2, 3, 4]; x[:-1]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"slice - step", "var x = [1, 2, 3, 4, 5]; x[::2]", interpreter.NewLoxArray([]any{1.0, 3.0, 5.0})},
+		{"slice - negative step", "var x = [1, 2, 3, 4, 5]; x[3:0:-2]", interpreter.NewLoxArray([]any{4.0, 2.0})},
+		{"slice - clamped", "var x = [1, 2, 3]; x[-10:10]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"slice - empty", "var x = [1, 2, 3]; x[2:1]", interpreter.NewLoxArray([]any{})},
+		{"slice - copies", "var x = [1, 2]; var y = x[:]; y[0] = 5; x", interpreter.NewLoxArray([]any{1.0, 2.0})},
+		{"string slice - reversed", `"hello"[::-1]`, "olleh"},
+		{"index with range", "var x = [1, 2, 3, 4]; x[1..2]", interpreter.NewLoxArray([]any{2.0, 3.0})},
+		{"string index with range", `"hello"[4..0 step -1]`, "olleh"},
+
+		// array references and mutation
+		{"arrays are shared by reference", "var a = [1]; var b = a; b[0] = 2; a", interpreter.NewLoxArray([]any{2.0})},
+		{"concatenation creates a new array", "var a = [1, 2]; pop(a); var b = a + [3]; var c = a + [4]; b", interpreter.NewLoxArray([]any{1.0, 3.0})},
+		{"concatenation does not change operands", "var a = [1]; var b = a + [2]; b[0] = 5; a", interpreter.NewLoxArray([]any{1.0})},
+		{"push", "var a = [1]; [push(a, 2), a]", interpreter.NewLoxArray([]any{2.0, interpreter.NewLoxArray([]any{1.0, 2.0})})},
+		{"push through alias", "var a = []; var b = a; push(b, 1); a", interpreter.NewLoxArray([]any{1.0})},
+		{"pop", "var a = [1, 2]; [pop(a), a]", interpreter.NewLoxArray([]any{2.0, interpreter.NewLoxArray([]any{1.0})})},
+		{"insert", "var a = [1, 3]; insert(a, 1, 2); insert(a, 3, 4); a", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0, 4.0})},
+		{"insert - negative index", "var a = [1, 3]; insert(a, -1, 2); a", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"removeAt", "var a = [1, 2, 3]; [removeAt(a, 1), a]", interpreter.NewLoxArray([]any{2.0, interpreter.NewLoxArray([]any{1.0, 3.0})})},
+		{"clear", "var a = [1, 2, 3]; clear(a); a", interpreter.NewLoxArray([]any{})},
+		{"indexOf", `[indexOf([1, "a", nil], "a"), indexOf([1], 2)]`, interpreter.NewLoxArray([]any{1.0, -1.0})},
+		{"contains", `[contains([1, "a"], "a"), contains([1], 2)]`, interpreter.NewLoxArray([]any{true, false})},
+		{"reverse", "var a = [1, 2, 3]; reverse(a); a", interpreter.NewLoxArray([]any{3.0, 2.0, 1.0})},
+		{"sort - default numbers", "sort([3, 1, 2], nil)", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"sort - default strings", `sort(["b", "c", "a"], nil)`, interpreter.NewLoxArray([]any{"a", "b", "c"})},
+		{"sort - comparator", "var a = [1, 3, 2]; sort(a, (x, y) => y - x); a", interpreter.NewLoxArray([]any{3.0, 2.0, 1.0})},
+		{"sort - stable", `sort([[1, "a"], [0, "b"], [1, "c"]], (x, y) => x[0] - y[0]) |> map(p => p[1])`, interpreter.NewLoxArray([]any{"b", "a", "c"})},
+		{"slice assignment - grow", "var a = [1, 2, 3]; a[1:2] = [4, 5, 6]; a", interpreter.NewLoxArray([]any{1.0, 4.0, 5.0, 6.0, 3.0})},
+		{"slice assignment - shrink", "var a = [1, 2, 3]; a[:2] = []; a", interpreter.NewLoxArray([]any{3.0})},
+		{"slice assignment - insert", "var a = [1, 2]; a[1:1] = [5]; a", interpreter.NewLoxArray([]any{1.0, 5.0, 2.0})},
+		{"slice assignment - step", "var a = [1, 2, 3, 4]; a[::2] = [0, 0]; a", interpreter.NewLoxArray([]any{0.0, 2.0, 0.0, 4.0})},
+		{"slice assignment - self", "var a = [1, 2]; a[2:] = a; a", interpreter.NewLoxArray([]any{1.0, 2.0, 1.0, 2.0})},
+		{"slice assignment - alias", "var a = [1, 2]; var b = a; a[:] = [3]; b", interpreter.NewLoxArray([]any{3.0})},
+
+		// equality and ordering
+		{"array equality", "[1, [2, \"a\"]] == [1, [2, \"a\"]]", true},
+		{"array inequality", "[[1, 2]] != [[1, 3]]", true},
+		{"array length inequality", "[1] == [1, 1]", false},
+		{"map equality", `{"a": [1], "b": 2} == {"b": 2, "a": [1]}`, true},
+		{"map inequality", `[{"a": 1} == {"a": 2}, {"a": 1} == {"b": 1}, {"a": 1} == {}]`, interpreter.NewLoxArray([]any{false, false, false})},
+		{"equality of different types", `[[] == {}, {} == nil, 1 == "1"]`, interpreter.NewLoxArray([]any{false, false, false})},
+		{"instance identity", `
+			class Foo {}
+			var foo = Foo()
+			[foo == foo, foo == Foo()]
+		`, interpreter.NewLoxArray([]any{true, false})},
+		{"instance equals method", `
+			class Point {
+				init(x) { this.x = x }
+				equals(other) { return instanceOf(other, Point) and other.x == this.x }
+			}
+			[Point(1) == Point(1), Point(1) != Point(2), Point(1) == 1]
+		`, interpreter.NewLoxArray([]any{true, true, false})},
+		{"equals method used by indexOf", `
+			class Point {
+				init(x) { this.x = x }
+				equals(other) { return other.x == this.x }
+			}
+			indexOf([Point(1), Point(2)], Point(2))
+		`, 1.0},
+		{"structural indexOf", "[contains([[1], [2]], [2]), indexOf([[1], [2]], [3])]", interpreter.NewLoxArray([]any{true, -1.0})},
+		{"cyclic array equality", "var a = [1]; push(a, a); var b = [1]; push(b, b); a == b", true},
+		{"cyclic array inequality", "var a = [1]; push(a, a); var b = [2]; push(b, b); a == b", false},
+		{"cyclic map equality", `var a = {}; a["self"] = a; var b = {}; b["self"] = b; a == b`, true},
+		{"string ordering", `["apple" < "banana", "b" <= "a", "b" > "B"]`, interpreter.NewLoxArray([]any{true, false, true})},
+		{"array ordering", "[[1, 2] < [1, 3], [1] < [1, 0], [2] > [1, 5], [\"a\"] >= [\"a\"]]", interpreter.NewLoxArray([]any{true, true, true, true})},
+		{"compare", `[compare(1, 2), compare("b", "a"), compare([1, 2], [1, 2])]`, interpreter.NewLoxArray([]any{-1.0, 1.0, 0.0})},
+		{"compare cyclic arrays", "var a = [1]; push(a, a); var b = [1]; push(b, b); compare(a, b)", 0.0},
+		{"sort with compare", `sort([[2, "b"], [1, "z"], [2, "a"]], compare)`, interpreter.NewLoxArray([]any{
+			interpreter.NewLoxArray([]any{1.0, "z"}), interpreter.NewLoxArray([]any{2.0, "a"}), interpreter.NewLoxArray([]any{2.0, "b"}),
+		})},
+
+		// ranges
+		{"range - inclusive", "[i for i of 1..3]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"range - exclusive", "[i for i of 1..<3]", interpreter.NewLoxArray([]any{1.0, 2.0})},
+		{"range - step", "[i for i of 0..10 step 5]", interpreter.NewLoxArray([]any{0.0, 5.0, 10.0})},
+		{"range - negative step", "[i for i of 3..<0 step -1]", interpreter.NewLoxArray([]any{3.0, 2.0, 1.0})},
+		{"range - empty", "[i for i of 3..1]", interpreter.NewLoxArray([]any{})},
+		{"range - expressions", "var n = 2; [i for i of n-1..n*2]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0, 4.0})},
+		{"range - for of", "var x = 0; for (var i of 1..4) x = x + i; x", 10.0},
+		{"range - lazy", "var x = 0; for (var i of 0..1000000000000) { if (i == 3) break; x = x + 1 }\n x", 3.0},
+		{"range - decimal number", "[i for i of 1.5..3]", interpreter.NewLoxArray([]any{1.5, 2.5})},
+		{"range - step is not reserved", "var step = 2; [i for i of 0..4 step step]", interpreter.NewLoxArray([]any{0.0, 2.0, 4.0})},
+		{"range - type", "type(1..2)", "range"},
 
 		// conditionals
 		{"if - true", "var x = 5; if (x < 6) x = x+1; x", 6.0},
@@ -131,6 +242,21 @@ world"`, "hello\nworld"},
 		{"for - no clauses", "var x = 0; for (;;) break; x", 0.0},
 		{"foreach", "var x = 0; var arr = [0,1,2,3,4]; for (var el of arr) x = el; x", 4.0},
 		{"foreach - empty array", "var x = -1; var arr = []; for (var el of arr) x = el; x", -1.0},
+
+		// comprehensions
+		{"array comprehension", "[x * 2 for x of [1, 2, 3]]", interpreter.NewLoxArray([]any{2.0, 4.0, 6.0})},
+		{"array comprehension - condition", "[x for x of [1, -2, 3, -4] if x > 0]", interpreter.NewLoxArray([]any{1.0, 3.0})},
+		{"array comprehension - multiple for clauses", `[a + b for a of ["a", "b"] for b of ["x", "y"] if a != "b" or b != "y"]`, interpreter.NewLoxArray([]any{"ax", "ay", "bx"})},
+		{"array comprehension - later clauses see earlier variables", "[y for x of [[1, 2], [3]] for y of x]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"array comprehension - empty", "[x for x of []]", interpreter.NewLoxArray([]any{})},
+		{"map comprehension", `{k: 1 for k of ["foo"]}`, interpreter.NewLoxMap(map[int]interpreter.MapPair{interpreter.Hash("foo"): {"foo", 1.0}})},
+		{"map comprehension - condition", `
+			var m = {"a": 1, "b": 2}
+			var n = {k: m[k] for k of keys(m) if m[k] > 1}
+			keys(n)
+		`, interpreter.NewLoxArray([]any{"b"})},
+		{"comprehension variables do not leak", `var x = "outer"; var y = [x for x of [1]]; x`, "outer"},
+		{"comprehension closures", `var fs = [() => x for x of [1, 2]]; fs[0]() + fs[1]()`, 3.0},
 		{"break", `var x = 0; while (x < 5) {
 				x = x + 1
 				if (x == 3) break
@@ -141,6 +267,45 @@ world"`, "hello\nworld"},
 				x = x + 1
 			}
 			x`, 4.0},
+		{"labeled break", `var x = 0
+			outer: for (var i = 0; i < 5; i = i + 1) {
+				for (var j = 0; j < 5; j = j + 1) {
+					if (j == 2) break outer
+					x = x + 1
+				}
+			}
+			x`, 2.0},
+		{"labeled continue", `var x = 0
+			outer: for (var i = 0; i < 3; i = i + 1) {
+				var j = 0
+				while (true) {
+					j = j + 1
+					if (j == 2) continue outer
+					x = x + 1
+				}
+			}
+			x`, 3.0},
+		{"labeled foreach", `var x = 0
+			rows: for (var row of [[1, 2], [3, 4]]) {
+				for (var el of row) {
+					if (el == 3) break rows
+					x = x + el
+				}
+			}
+			x`, 3.0},
+		{"unlabeled break inside labeled loop", `var x = 0
+			outer: while (x < 3) {
+				while (true) break
+				x = x + 1
+			}
+			x`, 3.0},
+		{"break after nested loop", `var x = 0
+			while (true) {
+				while (false) {}
+				x = x + 1
+				break
+			}
+			x`, 1.0},
 
 		// function declaration
 		{"function declaration", "fun x() {}\n x", &interpreter.LoxFunction{}},
@@ -154,6 +319,153 @@ world"`, "hello\nworld"},
 		{"return", "fun x(a,b) { return a+b }\n x(3,5)", 8.0},
 		{"lambda implicit return", "var x = (a,b) => a+b; x(3,5)", 8.0},
 
+		// pipelines
+		{"pipeline - first argument", "[1, -2, 3] |> map(a => a * 2) |> filter(a => a > 0)", interpreter.NewLoxArray([]any{2.0, 6.0})},
+		{"pipeline - placeholder", "[1, 2, 3] |> reduce(0, _, (acc, el) => acc + el)", 6.0},
+		{"pipeline - multiple placeholders", "var add = (a, b) => a + b; 2 |> add(_, _)", 4.0},
+		{"pipeline - plain function", "var double = a => a * 2; 5 |> double |> double", 20.0},
+		{"pipeline - line break after operator", "var double = a => a * 2; 5 |>\n double", 10.0},
+		{"pipeline - lower precedence than or", "var id = a => a; nil or 5 |> id", 5.0},
+		{"pipeline - assignment", "var double = a => a * 2; var x = 1; x = x |> double; x", 2.0},
+
+		// type annotations are ignored at runtime
+		{"annotated function", "fun add(a: number, b: number): number { return a + b }\n add(3, 5)", 8.0},
+		{"annotated variable", "var x: array<number>? = [1]; x", interpreter.NewLoxArray([]any{1.0})},
+		{"annotated lambda", "var f = (a: string, b) => a + b; f(\"a\", 1)", "a1"},
+		{"annotated class", `
+			class Point {
+				x: number
+				init(x: number) { this.x = x }
+				get double: number { return this.x * 2 }
+			}
+			Point(4).double`, 8.0},
+
+		// decorators
+		{"function decorator", `
+			fun double(f) { return a => f(a) * 2 }
+			@double
+			fun inc(x) { return x + 1 }
+			inc(1)
+		`, 4.0},
+		{"decorators apply bottom-up", `
+			fun double(f) { return a => f(a) * 2 }
+			fun inc(f) { return a => f(a) + 1 }
+			@double
+			@inc
+			fun id(x) { return x }
+			id(1)
+		`, 4.0},
+		{"decorator with arguments", `
+			fun add(n) { return f => a => f(a) + n }
+			@add(10)
+			fun id(x) { return x }
+			id(1)
+		`, 11.0},
+		{"recursive function uses decorated name", `
+			var calls = 0
+			fun count(f) { return n => { calls = calls + 1; return f(n) } }
+			@count
+			fun fact(n) { return n <= 1 ? 1 : n * fact(n - 1) }
+			fact(5)
+			calls
+		`, 5.0},
+		{"method decorator binds this", `
+			fun double(f) { return a => f(a) * 2 }
+			class Foo {
+				init(x) { this.x = x }
+				@double
+				add(a) { return this.x + a }
+			}
+			var add = Foo(3).add
+			add(2)
+		`, 10.0},
+		{"method decorator keeps state", `
+			var decorated = 0
+			fun count(f) {
+				decorated = decorated + 1
+				var calls = 0
+				return x => {
+					calls = calls + 1
+					return [calls, f(x)]
+				}
+			}
+			class A {
+				init(base) { this.base = base }
+				@count
+				m(x) { return this.base + x }
+			}
+			var a = A(10)
+			a.m(1)
+			var second = A(20).m
+			[second(2), a.m(3), decorated]
+		`, interpreter.NewLoxArray([]any{
+			interpreter.NewLoxArray([]any{2.0, 22.0}),
+			interpreter.NewLoxArray([]any{3.0, 13.0}),
+			1.0,
+		})},
+		{"method decorator wrapper calls nested wrapper", `
+			fun double(f) { return a => f(a) * 2 }
+			fun inc(f) { return a => { return f(a) + 1 } }
+			class Foo {
+				init(x) { this.x = x }
+				@double
+				@inc
+				add(a) { return this.x + a }
+			}
+			Foo(1).add(1)
+		`, 6.0},
+		{"method decorator applied per receiver", `
+			fun double(f) { return a => f(a) * 2 }
+			class Foo {
+				init(x) { this.x = x }
+				@double
+				add(a) { return this.x + a }
+			}
+			var one = Foo(1).add
+			var two = Foo(2).add
+			[one(1), two(1)]
+		`, interpreter.NewLoxArray([]any{4.0, 6.0})},
+		{"method decorator wrapper makes tail call", `
+			var log = []
+			fun logged(f) {
+				return a => {
+					push(log, a)
+					return f(a)
+				}
+			}
+			class Counter {
+				init() { this.count = 0 }
+				@logged
+				add(n) {
+					this.count = this.count + n
+					return this.count
+				}
+			}
+			var counter = Counter()
+			counter.add(2)
+			[counter.add(3), log]
+		`, interpreter.NewLoxArray([]any{5.0, interpreter.NewLoxArray([]any{2.0, 3.0})})},
+		{"getter and static decorators", `
+			fun double(f) { return () => f() * 2 }
+			class Foo {
+				init() { this.x = 3 }
+				@double
+				get twice { return this.x }
+				@double
+				static five() { return 5 }
+			}
+			[Foo().twice, Foo.five()]
+		`, interpreter.NewLoxArray([]any{6.0, 10.0})},
+		{"class decorator", `
+			fun singleton(c) {
+				var instance = c()
+				return () => instance
+			}
+			@singleton
+			class Foo {}
+			Foo() == Foo()
+		`, true},
+
 		// classes
 		{"class properties", `
 			class Test {}
@@ -274,27 +586,615 @@ world"`, "hello\nworld"},
 		{"size - map", `size({"foo": "bar"})`, 1.0},
 		{"hasKey - map", `hasKey({"foo": "bar"}, "foo")`, true},
 		{"hasKey - map", `hasKey({"foo": "bar"}, "bar")`, false},
-		{"keys - map", `keys({"foo": "bar"})`, interpreter.LoxArray{"foo"}},
-		{"values - map", `values({"foo": "bar"})`, interpreter.LoxArray{"bar"}},
+		{"keys - map", `keys({"foo": "bar"})`, interpreter.NewLoxArray([]any{"foo"})},
+		{"values - map", `values({"foo": "bar"})`, interpreter.NewLoxArray([]any{"bar"})},
 
-		{"map - array", "map([1,2,3], el => el*2)", interpreter.LoxArray{2.0, 4.0, 6.0}},
-		{"filter - array", "filter([1,2,3], el => el<3)", interpreter.LoxArray{1.0, 2.0}},
+		{"map - array", "map([1,2,3], el => el*2)", interpreter.NewLoxArray([]any{2.0, 4.0, 6.0})},
+		{"filter - array", "filter([1,2,3], el => el<3)", interpreter.NewLoxArray([]any{1.0, 2.0})},
 		{"reduce - array", "reduce(1, [1,2,3], (acc,el) => acc*el)", 6.0},
 
 		{"string - nil", `string(nil)`, "nil"},
 		{"string - array", `string(["hello", "world"])`, `["hello", "world"]`},
-		{"string - map", "string({})", "<map>"},
+		{"string - empty map", "string({})", "{}"},
+		{"string - map", `string({"b": [1, {"c": nil}], "a": "x"})`, `{"a": "x", "b": [1, {"c": nil}]}`},
 		{"string - lambda", "string(() => {})", "<lambda>"},
 		{"string - named function", "fun a() {}\n string(a)", "<fn a>"},
 		{"string - builtin", "string(clock)", "<native fn clock>"},
+		{"string - range", "string(1..<5 step 2)", "1..<5 step 2"},
 		{"string - class", `
 			class Foo {}
 			string(Foo)
 		`, "<class Foo>"},
 		{"string - instance", `
+			class Foo { init() { this.b = "x"; this.a = [1] } }
+			string(Foo())
+		`, `Foo {a: [1], b: "x"}`},
+		{"string - instance without fields", `
 			class Foo {}
 			string(Foo())
-		`, "<object Foo>"},
+		`, "Foo {}"},
+		{"string - toString", `
+			class Point {
+				init(x, y) { this.x = x; this.y = y }
+				toString() { return "(" + this.x + ", " + this.y + ")" }
+			}
+			string(Point(1, 2))
+		`, "(1, 2)"},
+		{"string - nested toString", `
+			class Point {
+				init(x) { this.x = x }
+				toString() { return "P" + this.x }
+			}
+			string({"p": [Point(1), Point(2)]})
+		`, `{"p": [P1, P2]}`},
+		{"string - inherited toString", `
+			class A { toString() { return "an A" } }
+			class B < A {}
+			string(B())
+		`, "an A"},
+		{"string - toString recursion", `
+			class Foo {
+				init() { this.x = 1 }
+				toString() { return "Foo: " + string(this) }
+			}
+			string(Foo())
+		`, "Foo: Foo {...}"},
+		{"concatenate - toString", `
+			class Foo { toString() { return "foo" } }
+			"a " + Foo() + Foo()
+		`, "a foofoo"},
+		{"string - cyclic array", "var a = [1]; push(a, a); string(a)", "[1, [...]]"},
+		{"string - cyclic map", `var m = {"a": 1}; m["self"] = m; string(m)`, `{"a": 1, "self": {...}}`},
+		{"string - cyclic instance", `
+			class Node { init() { this.next = this } }
+			string(Node())
+		`, "Node {next: Node {...}}"},
+		{"string - shared but not cyclic", "var a = [1]; string([a, a])", "[[1], [1]]"},
+
+		// reflection
+		{"type - number", "type(5)", "number"},
+		{"type - string", `type("hello")`, "string"},
+		{"type - nil", "type(nil)", "nil"},
+		{"type - array", "type([])", "array"},
+		{"type - map", "type({})", "map"},
+		{"type - function", "type(clock)", "function"},
+		{"type - class and instance", `
+			class Foo {}
+			[type(Foo), type(Foo())]
+		`, interpreter.NewLoxArray([]any{"class", "instance"})},
+		{"instanceOf - superclass", `
+			class A {}
+			class B < A {}
+			instanceOf(B(), A)
+		`, true},
+		{"instanceOf - unrelated class", `
+			class A {}
+			class B {}
+			instanceOf(B(), A)
+		`, false},
+		{"classOf", `
+			class Foo {}
+			classOf(Foo()) == Foo
+		`, true},
+		{"fields", `
+			class Foo { init() { this.b = 1; this.a = 2 } }
+			fields(Foo())
+		`, interpreter.NewLoxArray([]any{"a", "b"})},
+		{"methods - includes inherited", `
+			class A { foo() {} }
+			class B < A { bar() {} }
+			methods(B)
+		`, interpreter.NewLoxArray([]any{"bar", "foo"})},
+		{"getField and setField", `
+			class Foo {}
+			var foo = Foo()
+			setField(foo, "bar", 5)
+			getField(foo, "bar") + foo.bar
+		`, 10.0},
+		{"hasField", `
+			class Foo { init() { this.bar = nil } }
+			[hasField(Foo(), "bar"), hasField(Foo(), "baz")]
+		`, interpreter.NewLoxArray([]any{true, false})},
+		{"arity", "arity((a, b) => a)", 2.0},
+		{"doc - function", `
+			/// Adds two numbers.
+			/// Both must be numbers.
+			fun add(a, b) { return a + b }
+			doc(add)
+		`, "Adds two numbers.\nBoth must be numbers."},
+		{"doc - class and method", `
+			/// A greeter
+			class Greeter {
+				/// Says hello
+				hello() {}
+			}
+			[doc(Greeter), doc(Greeter().hello)]
+		`, interpreter.NewLoxArray([]any{"A greeter", "Says hello"})},
+		{"doc - undocumented", "fun a() {}\n doc(a)", nil},
+		{"doc - ordinary comments are not docs", `
+			// not a doc
+			//// not a doc either
+			fun a() {} /// trailing comments are not docs
+			doc(a)
+		`, nil},
+		{"arity - class", `
+			class Foo { init(a) {} }
+			arity(Foo)
+		`, 1.0},
+		{"freeze - returns value", `freeze([1, 2])`, &interpreter.LoxArray{Elements: []any{1.0, 2.0}, Frozen: true}},
+		{"freeze - isFrozen", `[isFrozen([1]), isFrozen(freeze([1])), isFrozen(freeze({})), isFrozen(1), isFrozen("a")]`, interpreter.NewLoxArray([]any{false, true, true, true, true})},
+		{"freeze - deep", `
+			var a = freeze([[1], {"b": [2]}])
+			[isFrozen(a[0]), isFrozen(a[1]), isFrozen(a[1]["b"])]
+		`, interpreter.NewLoxArray([]any{true, true, true})},
+		{"freeze - shallow", `
+			var a = freezeShallow([[1]])
+			a[0][0] = 2
+			[isFrozen(a), isFrozen(a[0]), a[0][0]]
+		`, interpreter.NewLoxArray([]any{true, false, 2.0})},
+		{"freeze - instance", `
+			class Foo { init() { this.a = [1]; } }
+			var foo = freeze(Foo())
+			isFrozen(foo) and isFrozen(foo.a)
+		`, true},
+		{"freeze - cycles", `
+			var a = [1]
+			push(a, a)
+			freeze(a)
+			isFrozen(a[1])
+		`, true},
+		{"freeze - copies are not frozen", `isFrozen(freeze([1]) + [2]) or isFrozen(freeze([1, 2])[:1])`, false},
+		{"map keys - numbers", `{1: "one", 2: "two"}[2]`, "two"},
+		{"map keys - frozen array", `
+			var m = {freeze([1, 2]): "found"}
+			m[freeze([1, 2])]
+		`, "found"},
+		{"map keys - frozen map", `
+			var m = {}
+			m[freeze({"x": 1, "y": 2})] = "found"
+			m[freeze({"y": 2, "x": 1})]
+		`, "found"},
+		{"map keys - frozen instance", `
+			class Point { init(x) { this.x = x; } }
+			var p = freeze(Point(1))
+			var m = {p: "found"}
+			[m[p], m[freeze(Point(1))]]
+		`, interpreter.NewLoxArray([]any{"found", nil})},
+		{"map keys - instances are keyed by identity", `
+			class K { init(x) { this.x = x } }
+			var a = freeze(K(1))
+			var b = freeze(K(1))
+			var m = {}
+			m[a] = "a"
+			m[b] = "b"
+			[a == b, size(m), m[a], m[b]]
+		`, interpreter.NewLoxArray([]any{false, 2.0, "a", "b"})},
+		{"map keys - record", `
+			record Point(x, y)
+			var m = {Point(1, 2): "found"}
+			[m[Point(1, 2)], m[Point(2, 1)]]
+		`, interpreter.NewLoxArray([]any{"found", nil})},
+		{"map keys - instance with equals", `
+			class Point {
+				init(x) { this.x = x }
+				equals(other) { return this.x == other.x }
+				hash() { return this.x }
+			}
+			var m = {freeze(Point(1)): "found"}
+			m[freeze(Point(1))]
+		`, "found"},
+		{"map keys - equal but distinct instances", `
+			class Id {
+				init(id, name) { this.id = id; this.name = name }
+				equals(other) { return this.id == other.id }
+				hash() { return this.id }
+			}
+			var a = freeze(Id(1, "a"))
+			var b = freeze(Id(1, "b"))
+			var m = {}
+			m[a] = "x"
+			[a == b, m[b], b in m, size(m)]
+		`, interpreter.NewLoxArray([]any{true, "x", true, 1.0})},
+		{"map keys - mutable key lookup", `[{"a": 1}[[1, 2]], {freeze([1, 2]): 1}[[1, 2]]]`, interpreter.NewLoxArray([]any{nil, nil})},
+		{"map keys - hasKey", `hasKey({freeze([1]): 1}, freeze([1])) and !hasKey({}, [1])`, true},
+		{"map keys - printed", `string({2: "b", 1: "a", "c": 3, freeze([1]): nil})`, `{[1]: nil, 1: "a", 2: "b", "c": 3}`},
+		{"record - construct", `
+			record Point(x, y)
+			var p = Point(1, 2)
+			[p.x, p.y]
+		`, interpreter.NewLoxArray([]any{1.0, 2.0})},
+		{"record - equality", `
+			record Point(x, y)
+			[Point(1, [2]) == Point(1, [2]), Point(1, 2) == Point(2, 1), Point(1, 2) != Point(1, 2)]
+		`, interpreter.NewLoxArray([]any{true, false, false})},
+		{"record - different records are not equal", `
+			record A(x)
+			record B(x)
+			A(1) == B(1)
+		`, false},
+		{"record - with", `
+			record Point(x, y)
+			var p = Point(1, 2)
+			var q = p.with({"y": 5})
+			[p.y, q.x, q.y]
+		`, interpreter.NewLoxArray([]any{2.0, 1.0, 5.0})},
+		{"record - as map key", `
+			record Point(x, y)
+			var m = {Point(0, 0): "origin"}
+			m[Point(0, 0)]
+		`, "origin"},
+		{"record - methods", `
+			record Size(w, h) {
+				area() { return this.w * this.h; }
+			}
+			Size(2, 3).area()
+		`, 6.0},
+		{"record - frozen", `
+			record Point(x)
+			isFrozen(Point([1])) and !isFrozen(Point([1]).x)
+		`, true},
+		{"record - arity", "record Point(x, y, z)\n arity(Point)", 3.0},
+		{"object literal", `
+			var o = object { name: "x", greet() { return "hi " + this.name } }
+			o.greet()
+		`, "hi x"},
+		{"object literal - multiline", `
+			var counter = object {
+				count: 0
+				get double { return this.count * 2 }
+				increment() { this.count = this.count + 1; return this }
+			}
+			counter.increment().increment().double
+		`, 4.0},
+		{"object literal - bound method", `
+			var o = object { name: "x", greet() { return "hi " + this.name } }
+			var greet = o.greet
+			greet()
+		`, "hi x"},
+		{"object literal - fields evaluated outside", `
+			class A {
+				init() { this.v = 1 }
+				wrap() { return object { v: this.v + 1, value() { return this.v } } }
+			}
+			A().wrap().value()
+		`, 2.0},
+		{"object - still an identifier", "var object = 5\n object", 5.0},
+		{"anonymous class", `
+			var A = class { init(x) { this.x = x } }
+			A(3).x
+		`, 3.0},
+		{"anonymous class - superclass", `
+			class Base { hello() { return "hello " + this.who() } }
+			var A = class < Base { who() { return "A" } }
+			A().hello()
+		`, "hello A"},
+		{"anonymous class - argument", `
+			fun make(cls) { return cls() }
+			make(class { get v { return 7 } }).v
+		`, 7.0},
+		{"spread - array", "var a = [1, 2]\n var b = [5]\n [...a, 3, ...b]", interpreter.NewLoxArray([]any{1.0, 2.0, 3.0, 5.0})},
+		{"spread - range", "[0, ...1..3]", interpreter.NewLoxArray([]any{0.0, 1.0, 2.0, 3.0})},
+		{"spread - copies array", "var a = [1]\n var b = [...a]\n push(b, 2)\n len(a)", 1.0},
+		{"spread - map", `
+			var defaults = {"host": "localhost", "port": 8080}
+			var m = {...defaults, "port": 80}
+			m["host"] + ":" + m["port"]
+		`, "localhost:80"},
+		{"spread - map later keys win", `
+			var defaults = {"port": 8080}
+			var m = {"port": 80, ...defaults}
+			m["port"]
+		`, 8080.0},
+		{"spread - map statement", "var defaults = {\"a\": 1}\n {...defaults}", interpreter.NewLoxMap(map[int]interpreter.MapPair{interpreter.Hash("a"): {Key: "a", Value: 1.0}})},
+		{"in - array", "[2 in [1, 2, 3], 4 in [1, 2, 3], [1] in [[1]]]", interpreter.NewLoxArray([]any{true, false, true})},
+		{"in - not in", "[4 not in [1, 2, 3], 2 not in [1, 2, 3]]", interpreter.NewLoxArray([]any{true, false})},
+		{"in - map", `["a" in {"a": nil}, "b" in {"a": 1}, [1] in {"a": 1}]`, interpreter.NewLoxArray([]any{true, false, false})},
+		{"in - string", `["ell" in "hello", "x" not in "hello"]`, interpreter.NewLoxArray([]any{true, true})},
+		{"in - range", "[3 in 1..5, 3.5 in 1..5, 4 in 0..10 step 2, 5 in 0..10 step 2, 5 in 0..<5, 2 in 5..0 step -1]", interpreter.NewLoxArray([]any{true, false, true, false, false, true})},
+		{"in - instance", `
+			class Evens { contains(x) { return x == 2 or x == 4 } }
+			[4 in Evens(), 3 not in Evens()]
+		`, interpreter.NewLoxArray([]any{true, true})},
+		{"in - precedence", "1 in [1] == 2 in [2]", true},
+		{"in - not is an identifier", "var not = 1\n not in [1]", true},
+		{"loop closures - for", `
+			var fs = []
+			for (var i = 0; i < 3; i = i + 1) push(fs, () => i)
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{0.0, 1.0, 2.0})},
+		{"loop closures - for of", `
+			var fs = []
+			for (var x of [1, 2, 3]) { push(fs, () => x) }
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"loop closures - for of range", `
+			var fs = []
+			for (var x of 1..3) { fun f() { return x * 10 } push(fs, f) }
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{10.0, 20.0, 30.0})},
+		{"loop closures - continue", `
+			var fs = []
+			for (var i = 0; i < 4; i = i + 1) {
+				if (i == 1) continue
+				push(fs, () => i)
+			}
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{0.0, 2.0, 3.0})},
+		{"loop closures - break", `
+			var fs = []
+			for (var i = 0; i < 10; i = i + 1) {
+				push(fs, () => i)
+				if (i == 1) break
+			}
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{0.0, 1.0})},
+		{"loop closures - body changes carry over", `
+			var seen = []
+			for (var i = 0; i < 5; i = i + 1) { i = i + 1; push(seen, i) }
+			seen
+		`, interpreter.NewLoxArray([]any{1.0, 3.0, 5.0})},
+		{"loop closures - closure assigns its own copy", `
+			var fs = []
+			for (var i = 0; i < 2; i = i + 1) push(fs, () => { i = i + 10; return i })
+			[fs[0](), fs[0](), fs[1]()]
+		`, interpreter.NewLoxArray([]any{10.0, 20.0, 11.0})},
+		{"loop closures - nested", `
+			var fs = []
+			for (var i = 0; i < 2; i = i + 1) for (var j of [0, 1]) push(fs, () => i * 2 + j)
+			map(fs, f => f())
+		`, interpreter.NewLoxArray([]any{0.0, 1.0, 2.0, 3.0})},
+		{"newlines - trailing operator", "var x = 1 +\n 2 *\n 3\n x", 7.0},
+		{"newlines - trailing logical operator", "var x = false or\n true and\n true\n x", true},
+		{"newlines - trailing assignment", "var x\n x =\n 5\n x", 5.0},
+		{"newlines - trailing var initializer", "var x =\n 5\n x", 5.0},
+		{"newlines - trailing ternary", "var x = true ?\n 1 :\n 2\n x", 1.0},
+		{"newlines - leading dot", "var x = [1, 2, 3]\n .map(x => x * 2)\n .filter(x => x > 2)\n x", interpreter.NewLoxArray([]any{4.0, 6.0})},
+		{"newlines - trailing dot", "var x = \"a\".\n upper()\n x", "A"},
+		{"newlines - leading pipeline", "var x = [1, 2]\n |> map(_, x => x + 1)\n |> len\n x", 2.0},
+		{"newlines - in parentheses", "var x = (1\n + 2\n )\n x", 3.0},
+		{"newlines - in call", "fun add(a, b) { return a + b }\n var x = add(\n 1\n ,\n 2\n )\n x", 3.0},
+		{"newlines - in array", "var x = [\n 1\n + 1\n ]\n x", interpreter.NewLoxArray([]any{2.0})},
+		{"newlines - in index", "var x = [1, 2]\n x[\n 1\n ]", 2.0},
+		{"newlines - in map", "var m = {\n \"a\"\n :\n 1\n }\n m[\"a\"]", 1.0},
+		{"newlines - in condition", "var x = 0\n if (true\n and\n true) x = 1\n x", 1.0},
+		{"newlines - in for clauses", "var x = 0\n for (var i = 0;\n i < 3;\n i = i + 1) x = x + i\n x", 3.0},
+		{"newlines - in parameters", "fun f(a,\n b\n ) { return a + b }\n f(1, 2)", 3.0},
+		{"newlines - block in brackets", `
+			var x = map([1, 2], n => {
+				var doubled = n * 2
+				return doubled
+			})
+			x
+		`, interpreter.NewLoxArray([]any{2.0, 4.0})},
+		{"newlines - object in brackets", `
+			var x = [object {
+				a: 1
+				b: 2
+			}]
+			x[0].a + x[0].b
+		`, 3.0},
+		{"newlines - leading minus starts a statement", "var x = 5\n -1\n x", 5.0},
+		{"newlines - leading paren starts a statement", "var x = 5\n (1)\n x", 5.0},
+		{"newlines - leading bracket starts a statement", "var x = 5\n [1]\n x", 5.0},
+		{"newlines - return ends at newline", "fun f() {\n return\n 5\n }\n f()", nil},
+		{"defer - runs on return in reverse order", `
+			var log = []
+			fun f() {
+				defer push(log, "first")
+				defer push(log, "second")
+				push(log, "body")
+				return len(log)
+			}
+			[f(), log]
+		`, interpreter.NewLoxArray([]any{1.0, interpreter.NewLoxArray([]any{"body", "second", "first"})})},
+		{"defer - arguments evaluated at defer", `
+			var log = []
+			fun f() {
+				var x = 1
+				defer push(log, x)
+				x = 2
+			}
+			f()
+			log
+		`, interpreter.NewLoxArray([]any{1.0})},
+		{"defer - runs at end of block", `
+			var log = []
+			{
+				defer push(log, "deferred")
+				push(log, "block")
+			}
+			push(log, "after")
+			log
+		`, interpreter.NewLoxArray([]any{"block", "deferred", "after"})},
+		{"defer - runs on break and continue", `
+			var log = []
+			for (var i = 0; i < 5; i = i + 1) {
+				defer push(log, i)
+				if (i == 0) continue
+				if (i == 2) break
+			}
+			log
+		`, interpreter.NewLoxArray([]any{0.0, 1.0, 2.0})},
+		{"defer - lambda", `
+			var log = []
+			fun f() {
+				defer (() => push(log, "cleanup"))()
+				return "result"
+			}
+			[f(), log]
+		`, interpreter.NewLoxArray([]any{"result", interpreter.NewLoxArray([]any{"cleanup"})})},
+		{"defer - returned call runs before deferred calls", `
+			var log = []
+			fun g() { push(log, "g") }
+			fun f() {
+				defer push(log, "deferred")
+				return g()
+			}
+			f()
+			log
+		`, interpreter.NewLoxArray([]any{"g", "deferred"})},
+		{"defer - recursion", `
+			var log = []
+			fun f(n) {
+				defer push(log, n)
+				if (n == 0) return nil
+				return f(n - 1)
+			}
+			f(2)
+			log
+		`, interpreter.NewLoxArray([]any{0.0, 1.0, 2.0})},
+		{"assert - passes", `
+			var x = 5
+			assert x > 0, "x must be positive"
+			x
+		`, 5.0},
+		{"contract - requires and ensures", `
+			fun double(x) requires x >= 0 ensures result == x * 2 { return x + x }
+			double(4)
+		`, 8.0},
+		{"contract - clauses on separate lines", `
+			fun clamp(x, low, high)
+				requires low <= high, "empty range"
+				ensures result >= low
+				ensures result <= high
+			{
+				if (x < low) return low
+				if (x > high) return high
+				return x
+			}
+			[clamp(-5, 0, 10), clamp(5, 0, 10), clamp(15, 0, 10)]
+		`, interpreter.NewLoxArray([]any{0.0, 5.0, 10.0})},
+		{"contract - result shadows parameter", `
+			fun f(result) ensures result == "returned" { return "returned" }
+			f("argument")
+		`, "returned"},
+		{"contract - method", `
+			class Counter {
+				init(start) requires start >= 0 { this.count = start }
+				increment() ensures result == this.count { this.count = this.count + 1; return this.count }
+			}
+			Counter(1).increment()
+		`, 2.0},
+		{"contract - tail call with ensures", `
+			fun count(n, acc) ensures result >= acc {
+				if (n == 0) return acc
+				return count(n - 1, acc + 1)
+			}
+			count(100, 0)
+		`, 100.0},
+		{"contract - requires checked on tail call", `
+			var checked = 0
+			fun positive(n) { checked = checked + 1; return n >= 0 }
+			fun count(n) requires positive(n) {
+				if (n == 0) return nil
+				return count(n - 1)
+			}
+			count(3)
+			checked
+		`, 4.0},
+		{"contract - words only special in clauses", `
+			var requires = 1
+			var ensures = 2
+			requires + ensures
+		`, 3.0},
+		{"eval - expression", `eval("1 + 2 * 3")`, 7.0},
+		{"eval - statements", `eval("var a = [1, 2]; push(a, 3); a")`, interpreter.NewLoxArray([]any{1.0, 2.0, 3.0})},
+		{"eval - no value", `eval("var a = 1")`, nil},
+		{"eval - declarations stay in eval", `
+			var a = "global"
+			eval("var a = 1")
+			a
+		`, "global"},
+		{"eval - sees globals", `
+			var limit = 10
+			eval("limit = limit * 2")
+			limit
+		`, 20.0},
+		{"eval - doesn't see caller's scope", `
+			var x = "global"
+			fun f() { var x = "local"; return eval("x") }
+			f()
+		`, "global"},
+		{"evalWith - variables", `evalWith("price * quantity > limit", {"price": 3, "quantity": 4, "limit": 10})`, true},
+		{"eval - functions outlive eval", `
+			var makeCounter = eval("fun make() { var n = 0; return () => { n = n + 1; return n } } make")
+			var counter = makeCounter()
+			counter()
+			var box = eval("class Box { init(v) { this.v = v } get value { var v = this.v; return v } } Box")
+			[counter(), box(5).value]
+		`, interpreter.NewLoxArray([]any{2.0, 5.0})},
+		{"eval - repeated", `
+			var total = 0
+			for (var i = 0; i < 100; i = i + 1) total = total + evalWith("var d = n * 2; d", {"n": i})
+			total
+		`, 9900.0},
+		{"evalWith - functions", `
+			fun square(x) { return x * x }
+			evalWith("fun twice(x) { return f(f(x)) } twice(n)", {"f": square, "n": 3})
+		`, 81.0},
+		{"method - string", `"Hello".upper()`, "HELLO"},
+		{"method - string chain", `" a,b ".trim().split(",")`, interpreter.NewLoxArray([]any{"a", "b"})},
+		{"method - string contains", `"hello".contains("ell") and !"hello".startsWith("e") and "hello".endsWith("lo")`, true},
+		{"method - string indexOf", `"hello".indexOf("l")`, 2.0},
+		{"method - string replace", `"a-b-c".replace("-", "+")`, "a+b+c"},
+		{"method - array", `[1, 2, 3].map(x => x * 2).filter(x => x > 2)`, interpreter.NewLoxArray([]any{4.0, 6.0})},
+		{"method - array reduce", `[1, 2, 3].reduce(0, (acc, x) => acc + x)`, 6.0},
+		{"method - array mutation", "var a = [1]\n a.push(2)\n a", interpreter.NewLoxArray([]any{1.0, 2.0})},
+		{"method - array join", `[1, "a", nil].join(", ")`, "1, a, nil"},
+		{"method - map", `{"a": 1}.keys()`, interpreter.NewLoxArray([]any{"a"})},
+		{"method - stored and called later", "var upper = \"abc\".upper\n upper()", "ABC"},
+		{"method - extension", `
+			extend("string", "shout", s => s.upper() + "!")
+			"hey".shout()
+		`, "HEY!"},
+		{"method - extension with arguments", `
+			fun times(n, f) { return n * f; }
+			extend("number", "times", times)
+			4.times(3)
+		`, 12.0},
+		{"method - extension overrides builtin", `
+			extend("array", "len", a => "overridden")
+			[1].len()
+		`, "overridden"},
+		{"contains native on strings", `contains("team", "i")`, false},
+		{"tail call - self recursion", `
+			fun count(n, acc) {
+				if (n == 0) return acc;
+				return count(n - 1, acc + 1);
+			}
+			count(200000, 0)
+		`, 200000.0},
+		{"tail call - mutual recursion", `
+			fun isEven(n) {
+				if (n == 0) return true;
+				return isOdd(n - 1);
+			}
+			fun isOdd(n) {
+				if (n == 0) return false;
+				return isEven(n - 1);
+			}
+			isEven(200001)
+		`, false},
+		{"tail call - method", `
+			class Counter {
+				init() { this.calls = 0; }
+				run(n) {
+					if (n == 0) return this.calls;
+					this.calls = this.calls + 1;
+					return this.run(n - 1);
+				}
+			}
+			Counter().run(100000)
+		`, 100000.0},
+		{"tail call - native in tail position", `
+			fun f(a) { return len(a); }
+			f([1, 2, 3])
+		`, 3.0},
+		{"tail call - initializer result", `
+			class Foo { init(a) { this.a = a; } }
+			fun make(a) { return Foo(a); }
+			make(5).a
+		`, 5.0},
 	}
 
 	for _, c := range cases {
@@ -338,7 +1238,20 @@ func TestPrint(t *testing.T) {
 	}{
 		{"print num", "print(5)", "5\n"},
 		{"print decimal", "print(5.4)", "5.4\n"},
+		{"print large number", "print(1e21)", "1e+21\n"},
+		{"print largest plain number", "print(123456789012345680000)", "123456789012345680000\n"},
+		{"print small number", "print(1.5e-7)", "1.5e-7\n"},
+		{"print smallest plain number", "print(0.000001)", "0.000001\n"},
+		{"print special numbers", "print([Infinity, -Infinity, NaN, 1 / 0])", "[Infinity, -Infinity, NaN, Infinity]\n"},
 		{"print string", `print("hello")`, "hello\n"},
+		{"print nested string", `print(["hello"])`, "[\"hello\"]\n"},
+		{"print map", `print({"a": 1})`, "{\"a\": 1}\n"},
+		{"print instance", "class Foo { init() { this.a = 1 } }\nprint(Foo())", "Foo {a: 1}\n"},
+		{"print toString", "class Foo { toString() { return \"foo\" } }\nprint(Foo())", "foo\n"},
+		{"print object", "print(object { b: 2, a: \"x\", f() {} })", "object {a: \"x\", b: 2}\n"},
+		{"print anonymous class", "print(class {})", "<class anonymous>\n"},
+		{"print record", "record Point(x, y)\nprint(Point(1, \"a\"))", "Point(x: 1, y: \"a\")\n"},
+		{"print nested record", "record Box(item)\nprint([Box(Box(nil))])", "[Box(item: Box(item: nil))]\n"},
 	}
 
 	for _, c := range cases {
@@ -376,6 +1289,124 @@ func TestPrint(t *testing.T) {
 	}
 }
 
+func TestDocComments(t *testing.T) {
+	errors := &lox_error.LoxErrors{}
+
+	s := scanner.NewScanner(`
+		/// the answer
+		var x = 42
+		/// a function
+		fun f() {}
+	`, errors)
+	tokens := s.ScanTokens()
+	assert.False(t, errors.HadScanningError())
+
+	p := parser.NewParser(tokens, errors)
+	statements := p.Parse()
+	assert.False(t, errors.HadParsingError())
+
+	assert.Equal(t, "the answer", statements[0].(*ast.VarStatement).Doc)
+	assert.Equal(t, "a function", statements[1].(*ast.FunctionStatement).Doc)
+}
+
+func TestChecker(t *testing.T) {
+	cases := []struct {
+		name        string
+		input       string
+		expectedMsg string
+	}{
+		{"unannotated code", "var x = 5; x = \"hello\"; fun f(a) { return a }\n f(1)", ""},
+		{"record constructor", "record Point(x: number, y: number)\n Point(1, 2)", ""},
+		{"record constructor types", "record Point(x: number, y: number)\n Point(1, \"a\")", "Invalid argument 2"},
+		{"record field types", "record Point(x: number)\n var s: string = Point(1).x", "Invalid initializer for 's'"},
+		{"record with", "record Point(x: number)\n var p: Point = Point(1).with({\"x\": 2})", ""},
+		{"record fields are read-only", "record Point(x)\n Point(1).x = 2", "Fields of record Point are read-only"},
+		{"object literal", "var s: string = object { n: 1, f(): number { return this.n } }.f()", "Invalid initializer for 's'"},
+		{"anonymous class", "var s: string = class { f(): number { return 1 } }().f()", "Invalid initializer for 's'"},
+		{"spread array type", "var a: array<number> = [1]\n var b: array<string> = [...a]", "Invalid initializer for 'b'"},
+		{"spread non-iterable", "[...5]", "Only arrays and ranges can be spread into an array literal, not number"},
+		{"spread map type", "var m = {\"a\": 1}\n var n: map<number> = {...m, \"b\": 2}", ""},
+		{"spread non-map", "{\"a\": 1, ...[1]}", "Only maps can be spread into a map literal, not array<number>"},
+		{"in number", "1 in 5", "Operator 'in' cannot be applied to number"},
+		{"in string", "1 in \"abc\"", "Only a string can be searched for in a string, not number"},
+		{"in array", "1 not in [1]", ""},
+		{"ensures result has return type", `fun f(x: number): string ensures result > 1 { return "a" }`, "Operator '>' cannot be applied to string and number"},
+		{"assert condition", `assert "a" - 1`, "Operand of '-' must be a number but got string"},
+		{"valid annotations", `
+			class A {}
+			class B < A { name: string }
+			fun f(a: A, n: number?): array<string> { return [] }
+			var b: B = B()
+			b.name = "foo"
+			f(b, nil)
+			var x: number = len(f(b, 5))
+		`, ""},
+		{"variable initializer", `var x: string = 5`, "Invalid initializer for 'x': expected string but got number"},
+		{"variable assignment", `var x: number = 5; x = "hello"`, "Invalid assignment to 'x': expected number but got string"},
+		{"argument type", "fun f(a: number) {}\n f(\"a\")", "Invalid argument 1: expected number but got string"},
+		{"argument count", "fun f(a: number) {}\n f(1, 2)", "Expected 1 arguments but got 2"},
+		{"return type", `fun f(): string { return 5 }`, "Invalid return value: expected string but got number"},
+		{"missing return value", `fun f(): string { return; }`, "Invalid return value: expected string but got nil"},
+		{"nullable", `var x: number? = nil; x * 2`, "Operand of '\\*' must be a number but got number\\?"},
+		{"inferred return type", "fun f(): string { return \"a\" }\n f() - 1", "Operand of '-' must be a number but got string"},
+		{"field type", `
+			class A { x: number }
+			var a = A()
+			a.x = "hello"
+		`, "Invalid value for field 'x': expected number but got string"},
+		{"setter type", `
+			class A { set x(value: number) {} }
+			A().x = "hello"
+		`, "Invalid value for setter 'x': expected number but got string"},
+		{"subclass", `
+			class A {}
+			class B {}
+			var a: A = B()
+		`, "expected A but got B"},
+		{"array element", `var x: array<number> = ["a", "b"]`, "expected array<number> but got array<string>"},
+		{"unknown type", `var x: foo = 5`, "Unknown type 'foo'"},
+		{"pipeline argument type", "fun f(n: number, s: string) {}\n 5 |> f(_, 6)", "Invalid argument 2: expected string but got number"},
+		{"slice assignment type", `var a: array<number> = [1]; a[:] = ["a"]`, "Invalid slice assignment: expected array<number> but got array<string>"},
+		{"ordering strings and arrays", `var x: boolean = "a" < "b" and [1] < [2]`, ""},
+		{"ordering types", `"a" < 1`, "Operator '<' cannot be applied to string and number"},
+		{"range bound type", `var r = 1.."a"`, "Operand of '..' must be a number but got string"},
+		{"range element type", `var x: array<string> = [i for i of 1..3]`, "expected array<string> but got array<number>"},
+		{"comprehension element type", `var x: array<string> = [n * 2 for n of [1, 2]]`, "expected array<string> but got array<number>"},
+		{"comprehension variable type", `var x: array<number> = [s + 1 for s of ["a"]]`, "expected array<number> but got array<string>"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reporter := &MockReporter{}
+			errors := lox_error.NewLoxErrors(reporter)
+
+			s := scanner.NewScanner(c.input, errors)
+			tokens := s.ScanTokens()
+			assert.False(t, errors.HadScanningError())
+
+			p := parser.NewParser(tokens, errors)
+			statements := p.Parse()
+			assert.False(t, errors.HadParsingError())
+
+			i := interpreter.NewInterpreter(errors)
+			r := resolver.NewResolver(i, errors)
+
+			r.Resolve(statements)
+			assert.False(t, errors.HadResolutionError())
+
+			ok := checker.NewChecker(errors).Check(statements)
+			if c.expectedMsg == "" {
+				assert.True(t, ok)
+				assert.False(t, errors.HadTypeError())
+			} else {
+				assert.False(t, ok)
+				assert.True(t, errors.HadTypeError())
+				assert.Regexp(t, c.expectedMsg, reporter.errorMessage)
+			}
+		})
+	}
+}
+
 type MockReporter struct {
 	errorMessage string
 }
@@ -391,6 +1422,13 @@ func TestScannerError(t *testing.T) {
 		expectedMsg string
 	}{
 		{"unexpected char", "~", "Unexpected character."},
+		{"unterminated block comment", "/* /* */", "Unterminated block comment."},
+		{"hex literal without digits", "0x", "Expect digits in hexadecimal literal."},
+		{"invalid binary digit", "0b102", "Invalid digit '2' in binary literal."},
+		{"invalid octal digit", "0o8", "Expect digits in octal literal."},
+		{"double digit separator", "1__000", "Digit separator must be between two digits."},
+		{"trailing digit separator", "1_", "Digit separator must be between two digits."},
+		{"separator before fraction", "1_.5", "Digit separator must be between two digits."},
 	}
 
 	for _, c := range cases {
@@ -413,6 +1451,20 @@ func TestParserError(t *testing.T) {
 		expectedMsg string
 	}{
 		{"invalid expression", "var x = ;", "Expect expression"},
+		{"label on non-loop", "a: print(5)", "Only loops can be labeled"},
+		{"record without fields", "record Point", "Expect '\\(' after record name."},
+		{"record field declared in body", "record Point(x) {\n y: number\n }", "Record fields must be declared in its parameter list"},
+		{"object field without separator", "object { a: 1 b: 2 }", "Expect ',' or newline after object field."},
+		{"unterminated object", "object { a: 1", "Expect '}' after object literal."},
+		{"newlines - leading operator", "var x = 1\n + 2", "Expect expression."},
+		{"newlines - unclosed bracket", "var x = [1,\n 2\n var y = 5", "Expect ']' after array literal"},
+		{"defer without call", "defer 5", "Expect a call after 'defer'"},
+		{"assert without condition", "assert", "Expect expression"},
+		{"clause without condition", "fun f(x) requires { return x }", "Expect expression"},
+		{"unterminated comprehension", "[x for x of [1]", "Expect ']' after array comprehension"},
+		{"comprehension without for", "[x if x]", "Expect ']' after array literal"},
+		{"decorator on variable", "fun d(f) { return f }\n@d var x = 5", "Decorators can only be applied to functions, methods and classes"},
+		{"decorator on field", "fun d(f) { return f }\nclass A { @d x: number }", "Decorators can only be applied to functions, methods and classes"},
 	}
 
 	for _, c := range cases {
@@ -439,6 +1491,14 @@ func TestResolverErrors(t *testing.T) {
 		expectedMsg string
 	}{
 		{"declare variable twice", `{var x = 5; var x = 6}`, "Already a variable with this name in scope"},
+		{"break to undefined label", `while (true) break outer`, "Undefined label 'outer'"},
+		{"record with init", "record Point(x) {\n init() {}\n }", "Records can't define an init method"},
+		{"object literal with init", "object { init() {} }", "Object literals can't define an init method"},
+		{"this in object field", "object { a: this }", "Can't use 'this' outside of a class"},
+		{"duplicate record field", "record P(x, y, x)", "Record already has a field named 'x'"},
+		{"duplicate object field", "var o = object { a: 1, b: 2, a: 3 }", "Object already has a field named 'a'"},
+		{"duplicate label", `a: while (true) { a: while (true) break a }`, "Label 'a' is already in use"},
+		{"break label across function boundary", `outer: while (true) { fun f() { while (true) break outer } }`, "Undefined label 'outer'"},
 	}
 
 	for _, c := range cases {
@@ -471,6 +1531,195 @@ func TestInterpreterErrors(t *testing.T) {
 		expectedMsg string
 	}{
 		{"negate only works on numbers", `-true`, "Operand must be a number"},
+		{"getField on missing field", `
+			class Foo {}
+			getField(Foo(), "bar")
+		`, "Undefined field 'bar'"},
+		{"instanceOf requires class", `instanceOf(5, 5)`, "second argument of instanceOf must be a class"},
+		{"index out of range", `[1, 2][-3]`, "Index is out of range"},
+		{"slice step of zero", `[1, 2][::0]`, "Slice step cannot be zero"},
+		{"slice maps", `{"a": 1}["a":]`, "Cannot slice maps"},
+		{"range bounds", `1.."a"`, "Range bounds must be numbers"},
+		{"range step of zero", `1..2 step 0`, "Range step cannot be zero"},
+		{"for of non-iterable", `for (var x of 5) print(x)`, "for-of loops are only valid on arrays and ranges"},
+		{"ordering mixed types", `1 < "a"`, "only valid for two numbers, two strings or two arrays"},
+		{"ordering maps", `{} < {}`, "only valid for two numbers, two strings or two arrays"},
+		{"compare mixed types", `compare([1], "a")`, "cannot compare array with string"},
+		{"compare mixed array elements", `compare([1], ["a"])`, "cannot compare number with string"},
+		{"toString must return a string", `
+			class Foo { toString() { return 5 } }
+			print(Foo())
+		`, "toString must return a string"},
+		{"concatenate instance without toString", `
+			class Foo {}
+			"a" + Foo()
+		`, "cannot concatenate string with type Foo {}"},
+		{"pop empty array", `pop([])`, "cannot pop from an empty array"},
+		{"removeAt out of range", `removeAt([1], 1)`, "index argument of removeAt is out of range"},
+		{"insert out of range", `insert([1], 3, 0)`, "index argument of insert is out of range"},
+		{"sort mixed without comparator", `sort([1, "a"], nil)`, "sort without a comparator requires an array of only numbers or only strings"},
+		{"sort comparator result", `sort([1, 2], (a, b) => "a")`, "comparator of sort must return a number"},
+		{"slice assignment of non-array", `var a = [1]; a[:] = 5`, "Can only assign an array to a slice"},
+		{"stepped slice assignment size", `var a = [1, 2, 3]; a[::2] = [1]`, "Cannot assign 1 elements to a stepped slice of 2 elements"},
+		{"pipeline into non-function", `5 |> 6`, "Can only call functions and classes"},
+		{"pipeline argument count", `var add = (a, b) => a + b; 5 |> add`, "Expected 2 arguments but got 1"},
+		{"comprehension over non-array", `[x for x of 5]`, "for clauses in comprehensions are only valid on arrays"},
+		{"map comprehension with mutable key", `var m = {[x]: x for x of [1]}`, "map keys must be immutable, freeze the array to use it as a key"},
+		{"frozen array index assignment", "var a = freeze([1])\n a[0] = 2", "Cannot modify a frozen array"},
+		{"frozen array slice assignment", "var a = freeze([1])\n a[:] = [2]", "Cannot modify a frozen array"},
+		{"frozen array natives", `push(freeze([1]), 2)`, "push cannot modify a frozen array"},
+		{"frozen array methods", `freeze([2, 1]).sort(nil)`, "sort cannot modify a frozen array"},
+		{"frozen map", "var m = freeze({\"a\": 1})\n m[\"a\"] = 2", "Cannot modify a frozen map"},
+		{"frozen instance", `
+			class Foo {}
+			var foo = freeze(Foo())
+			foo.bar = 1
+		`, "Cannot set property 'bar' of a frozen instance"},
+		{"frozen instance from method", `
+			class Foo { change() { this.bar = 1; } }
+			freeze(Foo()).change()
+		`, "Cannot set property 'bar' of a frozen instance"},
+		{"record fields are read-only", `
+			record Point(x)
+			Point(1).x = 2
+		`, "Cannot set property 'x' of a record, use with to copy it with changes"},
+		{"record with unknown field", `
+			record Point(x)
+			Point(1).with({"y": 2})
+		`, "record Point has no field \"y\""},
+		{"anonymous class with non-class superclass", `
+			var Base = 5
+			class < Base {}
+		`, "Superclass must be a class."},
+		{"spread non-iterable into array", `
+			var x = 5
+			[1, ...x]
+		`, "Only arrays and ranges can be spread into an array literal, not number"},
+		{"spread non-map into map", `
+			var x = [1]
+			var m = {"a": 1, ...x}
+		`, "Only maps can be spread into a map literal, not array"},
+		{"in non-collection", `
+			var x = 5
+			1 in x
+		`, "only valid for arrays, maps, ranges, strings and instances with a contains method"},
+		{"in string with non-string", `
+			var x = 1
+			x in "abc"
+		`, "Only a string can be searched for in a string"},
+		{"in instance without contains", `
+			class A {}
+			1 in A()
+		`, "only valid for arrays, maps, ranges, strings and instances with a contains method"},
+		{"assert fails", "var xs = [1, 2]\nassert len(xs) == 3", "Assertion failed: len\\(xs\\) == 3"},
+		{"assert fails with message", `assert 1 > 2, "one is " + string(1)`, "Assertion failed: 1 > 2 \\(one is 1\\)"},
+		{"requires fails", "fun f(x) requires x >= 0 { return x }\nf(-1)", "Precondition failed: x >= 0\n    in f, called at line 2"},
+		{"ensures fails", "fun f(x) ensures result > x { return x }\nf(1)", "Postcondition failed: result > x"},
+		{"ensures fails on tail call", `
+			fun f(n) ensures result != 0 {
+				if (n == 0) return 0
+				return f(n - 1)
+			}
+			f(3)
+		`, "Postcondition failed: result != 0"},
+		{"eval parse error", `eval("(1 +")`, "invalid source passed to eval: \\[line 1\\] Error at end: Expect expression"},
+		{"eval resolution error", `eval("return 1")`, "invalid source passed to eval: .*Can't return from top level code"},
+		{"eval runtime error", `eval("nil + 1")`, "only valid for two numbers"},
+		{"eval needs a string", "eval(1)", "argument of eval must be a string"},
+		{"evalWith needs a map", `evalWith("a", [])`, "second argument of evalWith must be a map"},
+		{"evalWith needs string names", `evalWith("a", {1: 2})`, "variable names passed to evalWith must be strings"},
+		{"record subclass", "record P(x)\nclass Q < P {}", "Records can't be subclassed"},
+		{"record anonymous subclass", "record P(x)\nclass < P {}", "Records can't be subclassed"},
+		{"record with needs a map", `
+			record Point(x)
+			Point(1).with(2)
+		`, "argument of with must be a map of field names to values"},
+		{"record arity", `
+			record Point(x, y)
+			Point(1)
+		`, "Expected 2 arguments but got 1"},
+		{"frozen instance setField", `
+			class Foo {}
+			setField(freeze(Foo()), "bar", 1)
+		`, "setField cannot modify a frozen instance"},
+		{"deep freeze", "var a = freeze([[1]])\n a[0][0] = 2", "Cannot modify a frozen array"},
+		{"shallow frozen key", `var m = {freezeShallow([[1]]): 1}`, "map keys must be immutable"},
+		{"equals without hash", `
+			class Id {
+				init(id) { this.id = id }
+				equals(other) { return this.id == other.id }
+			}
+			var m = {freeze(Id(1)): 1}
+		`, "instances of Id define equals, so need a hash method to be used as map keys"},
+		{"mutable key assignment", `var m = {}
+m[[1]] = 1`, "map keys must be immutable"},
+		{"decorator must be callable", "@5\nfun f() {}", "Decorator must be a function or class"},
+		{"decorator must take one argument", "fun d(a, b) {}\n@d\nfun f() {}", "Decorator must take 1 argument but takes 2"},
+		{"method decorator must return a function", `
+			fun d(f) { return 5 }
+			class A {
+				@d
+				foo() {}
+			}
+		`, "Method decorator must return a function"},
+		{"method passed to decorator called outside wrapper", `
+			var saved
+			fun save(f) { saved = f; return a => f(a) }
+			class A {
+				init() { this.name = "A" }
+				@save
+				who(a) { return this.name }
+			}
+			class B {
+				init() { this.name = "B" }
+				run() { var r = saved(1); return r }
+			}
+			A().who(1)
+			B().run()
+		`, "Method 'who' can only be called by the decorator wrapping it"},
+		{"method decorator must be callable", `
+			class A {
+				@5
+				foo() {}
+			}
+		`, "Decorator must be a function or class"},
+		{"stack trace", `
+			fun fail() { return nil + 1; }
+			fun outer() {
+				var x = fail();
+				return x;
+			}
+			outer()
+		`, "in fail, called at line 4\n    in outer, called at line 7"},
+		{"stack trace counts tail calls", `
+			fun fail(n) {
+				if (n == 0) return nil + 1;
+				return fail(n - 1);
+			}
+			fail(10)
+		`, "in fail, called at line 6 after 10 tail calls"},
+		{"stack overflow", `
+			fun f(n) { return 1 + f(n + 1); }
+			f(0)
+		`, "stack overflow: maximum call depth of 10000 exceeded calling f, declared at line 2"},
+		{"stack overflow in initializer", `
+			class A { init() { A(); } }
+			A()
+		`, "maximum call depth of 10000 exceeded calling A.init"},
+		{"stack overflow trace is shortened", `
+			fun a(n) { return 1 + b(n); }
+			fun b(n) { return 1 + a(n); }
+			a(0)
+		`, "\\.\\.\\. 9980 more calls"},
+		{"undefined method", `"abc".foo()`, "Undefined method 'foo' for type string"},
+		{"method arity", `[1].push()`, "Expected 1 arguments but got 0"},
+		{"extend unknown type", `extend("widget", "a", a => a)`, "first argument of extend must be the name of a built-in type"},
+		{"extend needs receiver parameter", `extend("string", "a", () => 1)`, "third argument of extend must be a function"},
+		{"tail call arity", `
+			fun f(a) { return a; }
+			fun g() { return f(); }
+			g()
+		`, "Expected 1 arguments but got 0"},
 	}
 
 	for _, c := range cases {
@@ -498,3 +1747,104 @@ func TestInterpreterErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxCallDepth(t *testing.T) {
+	input := `
+		fun depth(n) {
+			if (n == 0) return 0;
+			return 1 + depth(n - 1);
+		}
+		depth(50)
+	`
+	reporter := &MockReporter{}
+	errors := lox_error.NewLoxErrors(reporter)
+
+	statements := parser.NewParser(scanner.NewScanner(input, errors).ScanTokens(), errors).Parse()
+	i := interpreter.NewInterpreter(errors)
+	resolver.NewResolver(i, errors).Resolve(statements)
+
+	i.SetMaxCallDepth(20)
+	i.Interpret(statements)
+	assert.True(t, errors.HadRuntimeError())
+	assert.Regexp(t, "maximum call depth of 20 exceeded calling depth", reporter.errorMessage)
+
+	// the interpreter is still usable after a stack overflow, with new declarations
+	// made at the top level rather than in the scope the overflow happened in
+	errors.ResetError()
+	run := func(input string) any {
+		statements := parser.NewParser(scanner.NewScanner(input, errors).ScanTokens(), errors).Parse()
+		resolver.NewResolver(i, errors).Resolve(statements)
+		value, _ := i.Interpret(statements)
+		return value
+	}
+	run("var g = 5")
+	assert.Equal(t, 5.0, run("g"))
+	assert.False(t, errors.HadRuntimeError())
+
+	i.SetMaxCallDepth(100)
+	value, _ := i.Interpret(statements)
+	assert.False(t, errors.HadRuntimeError())
+	assert.Equal(t, 50.0, value)
+}
+
+func TestDeferOnRuntimeError(t *testing.T) {
+	reporter := &MockReporter{}
+	errors := lox_error.NewLoxErrors(reporter)
+	i := interpreter.NewInterpreter(errors)
+	run := func(input string) any {
+		statements := parser.NewParser(scanner.NewScanner(input, errors).ScanTokens(), errors).Parse()
+		resolver.NewResolver(i, errors).Resolve(statements)
+		value, _ := i.Interpret(statements)
+		return value
+	}
+
+	run(`
+		var log = []
+		fun f() {
+			defer push(log, "outer")
+			{
+				defer push(log, "inner")
+				nil + 1
+			}
+		}
+		f()
+	`)
+	assert.True(t, errors.HadRuntimeError())
+	assert.Regexp(t, "only valid for two numbers", reporter.errorMessage)
+
+	// the deferred calls ran as the error unwound the function
+	errors.ResetError()
+	assert.Equal(t, interpreter.NewLoxArray([]any{"inner", "outer"}), run("log"))
+	assert.False(t, errors.HadRuntimeError())
+}
+
+func TestDisabledAssertions(t *testing.T) {
+	input := `
+		var evaluated = false
+		fun check() { evaluated = true; return false }
+		fun count(n, acc) requires check() ensures check() {
+			if (n == 0) return acc
+			return count(n - 1, acc + 1)
+		}
+		assert check(), "not checked"
+		[count(50, 0), evaluated]
+	`
+	reporter := &MockReporter{}
+	errors := lox_error.NewLoxErrors(reporter)
+
+	statements := parser.NewParser(scanner.NewScanner(input, errors).ScanTokens(), errors).Parse()
+	i := interpreter.NewInterpreter(errors)
+	resolver.NewResolver(i, errors).Resolve(statements)
+
+	// conditions aren't evaluated, and the ensures clause doesn't stop tail calls
+	i.SetAssertions(false)
+	i.SetMaxCallDepth(20)
+	value, _ := i.Interpret(statements)
+	assert.False(t, errors.HadRuntimeError())
+	assert.Equal(t, interpreter.NewLoxArray([]any{50.0, false}), value)
+
+	i.SetAssertions(true)
+	i.Interpret(statements)
+	assert.True(t, errors.HadRuntimeError())
+	assert.Regexp(t, "Assertion failed: check\\(\\) \\(not checked\\)", reporter.errorMessage)
+}
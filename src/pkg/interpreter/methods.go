@@ -0,0 +1,272 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hutcho66/glox/src/pkg/token"
+)
+
+// builtinMethods are the methods of the built-in types, keyed by type name and then
+// method name. Each method takes the value it is called on as its first argument,
+// so most of them are the natives that already work that way.
+var builtinMethods = map[string]map[string]LoxCallable{
+	"string": {
+		"len":        &Length{},
+		"contains":   &Contains{},
+		"indexOf":    &IndexOf{},
+		"upper":      &Upper{},
+		"lower":      &Lower{},
+		"trim":       &Trim{},
+		"split":      &Split{},
+		"startsWith": &StartsWith{},
+		"endsWith":   &EndsWith{},
+		"replace":    &Replace{},
+	},
+	"array": {
+		"len":      &Length{},
+		"map":      &Map{},
+		"filter":   &Filter{},
+		"reduce":   &reduceMethod{},
+		"push":     &Push{},
+		"pop":      &Pop{},
+		"insert":   &Insert{},
+		"removeAt": &RemoveAt{},
+		"clear":    &Clear{},
+		"indexOf":  &IndexOf{},
+		"contains": &Contains{},
+		"reverse":  &Reverse{},
+		"sort":     &Sort{},
+		"join":     &Join{},
+	},
+	"map": {
+		"size":   &Size{},
+		"keys":   &Keys{},
+		"values": &Values{},
+		"hasKey": &HasKey{},
+	},
+}
+
+// extensibleTypes are the types that scripts can add methods to with extend
+var extensibleTypes = []string{"nil", "boolean", "number", "string", "array", "map", "range"}
+
+// BoundMethod is a method of a built-in type bound to the value it was accessed on
+type BoundMethod struct {
+	Receiver any
+	Method   LoxCallable
+	name     string
+}
+
+func (b *BoundMethod) Arity() int {
+	return b.Method.Arity() - 1
+}
+
+func (b *BoundMethod) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return b.Method.Call(interpreter, append([]any{b.Receiver}, arguments...))
+}
+
+// method looks up a method of a value that isn't an object, preferring methods
+// added by the script over the built-in ones
+func (i *Interpreter) method(value any, name *token.Token) (*BoundMethod, error) {
+	typeName := typeName(value)
+	if method, ok := i.extensions[typeName][name.Lexeme]; ok {
+		return &BoundMethod{Receiver: value, Method: method, name: name.Lexeme}, nil
+	}
+	if method, ok := builtinMethods[typeName][name.Lexeme]; ok {
+		return &BoundMethod{Receiver: value, Method: method, name: name.Lexeme}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Undefined method '%s' for type %s", name.Lexeme, typeName))
+}
+
+type Extend struct{}
+
+func (Extend) Arity() int {
+	return 3
+}
+
+func (Extend) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	typeName, isString := arguments[0].(string)
+	name, isName := arguments[1].(string)
+	function, isFunction := arguments[2].(LoxCallable)
+
+	if !isString || !slices.Contains(extensibleTypes, typeName) {
+		return nil, errors.New("first argument of extend must be the name of a built-in type: " + strings.Join(extensibleTypes, ", "))
+	}
+
+	if !isName {
+		return nil, errors.New("second argument of extend must be a string")
+	}
+
+	if !isFunction || function.Arity() < 1 {
+		return nil, errors.New("third argument of extend must be a function taking the value the method is called on as its first parameter")
+	}
+
+	if interpreter.extensions[typeName] == nil {
+		interpreter.extensions[typeName] = map[string]LoxCallable{}
+	}
+	interpreter.extensions[typeName][name] = function
+	return nil, nil
+}
+
+func (Extend) Name() string {
+	return "extend"
+}
+
+// reduceMethod is reduce with the array as the first argument
+type reduceMethod struct{}
+
+func (reduceMethod) Arity() int {
+	return 3
+}
+
+func (reduceMethod) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return Reduce{}.Call(interpreter, []any{arguments[1], arguments[0], arguments[2]})
+}
+
+type Upper struct{}
+
+func (Upper) Arity() int {
+	return 1
+}
+
+func (Upper) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return strings.ToUpper(arguments[0].(string)), nil
+}
+
+func (Upper) Name() string {
+	return "upper"
+}
+
+type Lower struct{}
+
+func (Lower) Arity() int {
+	return 1
+}
+
+func (Lower) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return strings.ToLower(arguments[0].(string)), nil
+}
+
+func (Lower) Name() string {
+	return "lower"
+}
+
+type Trim struct{}
+
+func (Trim) Arity() int {
+	return 1
+}
+
+func (Trim) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return strings.TrimSpace(arguments[0].(string)), nil
+}
+
+func (Trim) Name() string {
+	return "trim"
+}
+
+type Split struct{}
+
+func (Split) Arity() int {
+	return 2
+}
+
+func (Split) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	separator, isString := arguments[1].(string)
+	if !isString {
+		return nil, errors.New("argument of split must be a string")
+	}
+
+	parts := strings.Split(arguments[0].(string), separator)
+	elements := make([]any, len(parts))
+	for i, part := range parts {
+		elements[i] = part
+	}
+	return NewLoxArray(elements), nil
+}
+
+func (Split) Name() string {
+	return "split"
+}
+
+type StartsWith struct{}
+
+func (StartsWith) Arity() int {
+	return 2
+}
+
+func (StartsWith) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	prefix, isString := arguments[1].(string)
+	if !isString {
+		return nil, errors.New("argument of startsWith must be a string")
+	}
+	return strings.HasPrefix(arguments[0].(string), prefix), nil
+}
+
+func (StartsWith) Name() string {
+	return "startsWith"
+}
+
+type EndsWith struct{}
+
+func (EndsWith) Arity() int {
+	return 2
+}
+
+func (EndsWith) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	suffix, isString := arguments[1].(string)
+	if !isString {
+		return nil, errors.New("argument of endsWith must be a string")
+	}
+	return strings.HasSuffix(arguments[0].(string), suffix), nil
+}
+
+func (EndsWith) Name() string {
+	return "endsWith"
+}
+
+type Replace struct{}
+
+func (Replace) Arity() int {
+	return 3
+}
+
+func (Replace) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	old, isOldString := arguments[1].(string)
+	replacement, isNewString := arguments[2].(string)
+	if !isOldString || !isNewString {
+		return nil, errors.New("arguments of replace must be strings")
+	}
+	return strings.ReplaceAll(arguments[0].(string), old, replacement), nil
+}
+
+func (Replace) Name() string {
+	return "replace"
+}
+
+type Join struct{}
+
+func (Join) Arity() int {
+	return 2
+}
+
+func (Join) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	separator, isString := arguments[1].(string)
+	if !isString {
+		return nil, errors.New("argument of join must be a string")
+	}
+
+	array := arguments[0].(*LoxArray)
+	parts := make([]string, len(array.Elements))
+	for i, element := range array.Elements {
+		parts[i] = interpreter.printRepresentation(element)
+	}
+	return strings.Join(parts, separator), nil
+}
+
+func (Join) Name() string {
+	return "join"
+}
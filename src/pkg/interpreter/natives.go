@@ -3,6 +3,9 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/maps"
@@ -21,10 +24,36 @@ var Natives = []LoxNative{
 	&Map{},
 	&Filter{},
 	&Reduce{},
+	&Push{},
+	&Pop{},
+	&Insert{},
+	&RemoveAt{},
+	&Clear{},
+	&IndexOf{},
+	&Contains{},
+	&Reverse{},
+	&Sort{},
+	&Compare{},
 	&HasKey{},
 	&Size{},
 	&Values{},
 	&Keys{},
+	&Type{},
+	&InstanceOf{},
+	&ClassOf{},
+	&Fields{},
+	&Methods{},
+	&GetField{},
+	&SetField{},
+	&HasField{},
+	&Arity{},
+	&Doc{},
+	&Extend{},
+	&Freeze{},
+	&FreezeShallow{},
+	&IsFrozen{},
+	&Eval{},
+	&EvalWith{},
 }
 
 type Clock struct{}
@@ -48,7 +77,7 @@ func (Print) Arity() int {
 }
 
 func (Print) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	fmt.Println(PrintRepresentation(arguments[0]))
+	fmt.Println(interpreter.printRepresentation(arguments[0]))
 	return nil, nil
 }
 
@@ -66,7 +95,7 @@ func (String) Call(interpreter *Interpreter, arguments []any) (any, error) {
 	if s, ok := arguments[0].(string); ok {
 		return s, nil
 	}
-	return Representation(arguments[0]), nil
+	return interpreter.representation(arguments[0]), nil
 }
 
 func (String) Name() string {
@@ -81,8 +110,8 @@ func (Length) Arity() int {
 
 func (Length) Call(interpreter *Interpreter, arguments []any) (any, error) {
 	switch val := arguments[0].(type) {
-	case LoxArray:
-		return float64(len(val)), nil
+	case *LoxArray:
+		return float64(len(val.Elements)), nil
 	case string:
 		return float64(len(val)), nil
 	}
@@ -101,8 +130,8 @@ func (Size) Arity() int {
 
 func (Size) Call(interpreter *Interpreter, arguments []any) (any, error) {
 	switch val := arguments[0].(type) {
-	case LoxMap:
-		return float64(len(val)), nil
+	case *LoxMap:
+		return float64(len(val.Pairs)), nil
 	}
 	return nil, errors.New("can only call size on maps")
 }
@@ -118,7 +147,7 @@ func (Map) Arity() int {
 }
 
 func (Map) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	array, isArray := arguments[0].(LoxArray)
+	array, isArray := arguments[0].(*LoxArray)
 	function, isFunction := arguments[1].(LoxCallable)
 
 	if !isArray {
@@ -129,8 +158,8 @@ func (Map) Call(interpreter *Interpreter, arguments []any) (any, error) {
 		return nil, errors.New("second argument of map must be an function taking a single parameter")
 	}
 
-	results := make(LoxArray, len(array))
-	for i, element := range array {
+	results := make([]any, len(array.Elements))
+	for i, element := range array.Elements {
 		result, err := function.Call(interpreter, []any{element})
 		if err != nil {
 			return nil, err
@@ -138,7 +167,7 @@ func (Map) Call(interpreter *Interpreter, arguments []any) (any, error) {
 		results[i] = result
 	}
 
-	return results, nil
+	return NewLoxArray(results), nil
 }
 
 func (Map) Name() string {
@@ -153,7 +182,7 @@ func (Reduce) Arity() int {
 
 func (Reduce) Call(interpreter *Interpreter, arguments []any) (any, error) {
 	initializer := arguments[0]
-	array, isArray := arguments[1].(LoxArray)
+	array, isArray := arguments[1].(*LoxArray)
 	function, isFunction := arguments[2].(LoxCallable)
 
 	if !isArray {
@@ -166,7 +195,7 @@ func (Reduce) Call(interpreter *Interpreter, arguments []any) (any, error) {
 
 	accumulator := initializer
 	var err error
-	for _, element := range array {
+	for _, element := range array.Elements {
 		accumulator, err = function.Call(interpreter, []any{accumulator, element})
 		if err != nil {
 			return nil, err
@@ -187,7 +216,7 @@ func (Filter) Arity() int {
 }
 
 func (Filter) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	array, isArray := arguments[0].(LoxArray)
+	array, isArray := arguments[0].(*LoxArray)
 	function, isFunction := arguments[1].(LoxCallable)
 
 	if !isArray {
@@ -198,8 +227,8 @@ func (Filter) Call(interpreter *Interpreter, arguments []any) (any, error) {
 		return nil, errors.New("second argument of map must be an function taking a single parameter")
 	}
 
-	results := make(LoxArray, 0, len(array))
-	for _, element := range array {
+	results := make([]any, 0, len(array.Elements))
+	for _, element := range array.Elements {
 		result, err := function.Call(interpreter, []any{element})
 		if err != nil {
 			return nil, err
@@ -209,13 +238,342 @@ func (Filter) Call(interpreter *Interpreter, arguments []any) (any, error) {
 		}
 	}
 
-	return results, nil
+	return NewLoxArray(results), nil
 }
 
 func (Filter) Name() string {
 	return "filter"
 }
 
+// nativeIndex converts an index argument to a position in an array, negative indices count back from the end.
+// If allowEnd is true, the position just past the last element is also valid.
+func nativeIndex(value any, length int, allowEnd bool, native string) (int, error) {
+	index, isNumber := value.(float64)
+	if !isNumber || !isInteger(index) {
+		return 0, fmt.Errorf("index argument of %s must be an integer", native)
+	}
+
+	position := int(index)
+	if position < 0 {
+		position += length
+	}
+
+	upper := length - 1
+	if allowEnd {
+		upper = length
+	}
+	if position < 0 || position > upper {
+		return 0, fmt.Errorf("index argument of %s is out of range", native)
+	}
+	return position, nil
+}
+
+type Push struct{}
+
+func (Push) Arity() int {
+	return 2
+}
+
+func (Push) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of push must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("push cannot modify a frozen array")
+	}
+
+	array.Elements = append(array.Elements, arguments[1])
+	return float64(len(array.Elements)), nil
+}
+
+func (Push) Name() string {
+	return "push"
+}
+
+type Pop struct{}
+
+func (Pop) Arity() int {
+	return 1
+}
+
+func (Pop) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("argument of pop must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("pop cannot modify a frozen array")
+	}
+	if len(array.Elements) == 0 {
+		return nil, errors.New("cannot pop from an empty array")
+	}
+
+	last := len(array.Elements) - 1
+	element := array.Elements[last]
+	array.Elements = slices.Delete(array.Elements, last, last+1)
+	return element, nil
+}
+
+func (Pop) Name() string {
+	return "pop"
+}
+
+type Insert struct{}
+
+func (Insert) Arity() int {
+	return 3
+}
+
+func (Insert) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of insert must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("insert cannot modify a frozen array")
+	}
+
+	position, err := nativeIndex(arguments[1], len(array.Elements), true, "insert")
+	if err != nil {
+		return nil, err
+	}
+
+	array.Elements = slices.Insert(array.Elements, position, arguments[2])
+	return nil, nil
+}
+
+func (Insert) Name() string {
+	return "insert"
+}
+
+type RemoveAt struct{}
+
+func (RemoveAt) Arity() int {
+	return 2
+}
+
+func (RemoveAt) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of removeAt must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("removeAt cannot modify a frozen array")
+	}
+
+	position, err := nativeIndex(arguments[1], len(array.Elements), false, "removeAt")
+	if err != nil {
+		return nil, err
+	}
+
+	element := array.Elements[position]
+	array.Elements = slices.Delete(array.Elements, position, position+1)
+	return element, nil
+}
+
+func (RemoveAt) Name() string {
+	return "removeAt"
+}
+
+type Clear struct{}
+
+func (Clear) Arity() int {
+	return 1
+}
+
+func (Clear) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("argument of clear must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("clear cannot modify a frozen array")
+	}
+
+	array.Elements = []any{}
+	return nil, nil
+}
+
+func (Clear) Name() string {
+	return "clear"
+}
+
+type IndexOf struct{}
+
+func (IndexOf) Arity() int {
+	return 2
+}
+
+func (IndexOf) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	if s, isString := arguments[0].(string); isString {
+		substring, ok := arguments[1].(string)
+		if !ok {
+			return nil, errors.New("second argument of indexOf must be a string when searching a string")
+		}
+		return float64(strings.Index(s, substring)), nil
+	}
+
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of indexOf must be an array or string")
+	}
+
+	for i, element := range array.Elements {
+		if interpreter.isEqual(element, arguments[1]) {
+			return float64(i), nil
+		}
+	}
+	return -1.0, nil
+}
+
+func (IndexOf) Name() string {
+	return "indexOf"
+}
+
+type Contains struct{}
+
+func (Contains) Arity() int {
+	return 2
+}
+
+func (Contains) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	if s, isString := arguments[0].(string); isString {
+		substring, ok := arguments[1].(string)
+		if !ok {
+			return nil, errors.New("second argument of contains must be a string when searching a string")
+		}
+		return strings.Contains(s, substring), nil
+	}
+
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of contains must be an array or string")
+	}
+
+	return slices.ContainsFunc(array.Elements, func(element any) bool {
+		return interpreter.isEqual(element, arguments[1])
+	}), nil
+}
+
+func (Contains) Name() string {
+	return "contains"
+}
+
+type Reverse struct{}
+
+func (Reverse) Arity() int {
+	return 1
+}
+
+func (Reverse) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("argument of reverse must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("reverse cannot modify a frozen array")
+	}
+
+	slices.Reverse(array.Elements)
+	return array, nil
+}
+
+func (Reverse) Name() string {
+	return "reverse"
+}
+
+type Sort struct{}
+
+func (Sort) Arity() int {
+	return 2
+}
+
+func (Sort) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	array, isArray := arguments[0].(*LoxArray)
+	if !isArray {
+		return nil, errors.New("first argument of sort must be an array")
+	}
+	if array.Frozen {
+		return nil, errors.New("sort cannot modify a frozen array")
+	}
+
+	// without a comparator, arrays of only numbers or only strings are sorted in ascending order
+	if arguments[1] == nil {
+		if isAll[float64](array.Elements) {
+			sort.SliceStable(array.Elements, func(i, j int) bool {
+				return array.Elements[i].(float64) < array.Elements[j].(float64)
+			})
+		} else if isAll[string](array.Elements) {
+			sort.SliceStable(array.Elements, func(i, j int) bool {
+				return array.Elements[i].(string) < array.Elements[j].(string)
+			})
+		} else {
+			return nil, errors.New("sort without a comparator requires an array of only numbers or only strings")
+		}
+		return array, nil
+	}
+
+	comparator, isFunction := arguments[1].(LoxCallable)
+	if !isFunction || comparator.Arity() != 2 {
+		return nil, errors.New("second argument of sort must be nil or a function taking two parameters")
+	}
+
+	// sort a copy, so the array is left untouched if the comparator fails
+	elements := slices.Clone(array.Elements)
+	var err error
+	sort.SliceStable(elements, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+
+		var result any
+		result, err = comparator.Call(interpreter, []any{elements[i], elements[j]})
+		order, isNumber := result.(float64)
+		if err == nil && !isNumber {
+			err = errors.New("comparator of sort must return a number")
+		}
+		return order < 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	array.Elements = elements
+	return array, nil
+}
+
+func (Sort) Name() string {
+	return "sort"
+}
+
+type Compare struct{}
+
+func (Compare) Arity() int {
+	return 2
+}
+
+func (Compare) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	order, err := interpreter.compare(arguments[0], arguments[1])
+	if err != nil {
+		return nil, err
+	}
+	return float64(order), nil
+}
+
+func (Compare) Name() string {
+	return "compare"
+}
+
+func isAll[T any](elements []any) bool {
+	for _, element := range elements {
+		if _, ok := element.(T); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 type HasKey struct{}
 
 func (HasKey) Arity() int {
@@ -223,20 +581,14 @@ func (HasKey) Arity() int {
 }
 
 func (HasKey) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	m, isMap := arguments[0].(LoxMap)
-	key, isString := arguments[1].(string)
+	m, isMap := arguments[0].(*LoxMap)
+	key := arguments[1]
 
 	if !isMap {
 		return nil, errors.New("first argument of hasKey must be a map")
 	}
 
-	if !isString {
-		return nil, errors.New("second argument of hasKey must be a string")
-	}
-
-	hash := Hash(key)
-
-	_, ok := m[hash]
+	_, ok := interpreter.lookup(m, key)
 	return ok, nil
 }
 
@@ -251,19 +603,19 @@ func (Values) Arity() int {
 }
 
 func (Values) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	m, isMap := arguments[0].(LoxMap)
+	m, isMap := arguments[0].(*LoxMap)
 
 	if !isMap {
 		return nil, errors.New("argument of values must be a map")
 	}
 
-	pairs := maps.Values(m)
-	values := make(LoxArray, len(pairs))
+	pairs := maps.Values(m.Pairs)
+	values := make([]any, len(pairs))
 	for i, pair := range pairs {
 		values[i] = pair.Value
 	}
 
-	return values, nil
+	return NewLoxArray(values), nil
 }
 
 func (Values) Name() string {
@@ -277,21 +629,309 @@ func (Keys) Arity() int {
 }
 
 func (Keys) Call(interpreter *Interpreter, arguments []any) (any, error) {
-	m, isMap := arguments[0].(LoxMap)
+	m, isMap := arguments[0].(*LoxMap)
 
 	if !isMap {
 		return nil, errors.New("argument of keys must be a map")
 	}
 
-	pairs := maps.Values(m)
-	keys := make(LoxArray, len(pairs))
+	pairs := maps.Values(m.Pairs)
+	keys := make([]any, len(pairs))
 	for i, pair := range pairs {
 		keys[i] = pair.Key
 	}
 
-	return keys, nil
+	return NewLoxArray(keys), nil
 }
 
 func (Keys) Name() string {
 	return "keys"
 }
+
+type Type struct{}
+
+func (Type) Arity() int {
+	return 1
+}
+
+func (Type) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return typeName(arguments[0]), nil
+}
+
+func (Type) Name() string {
+	return "type"
+}
+
+// typeName returns the name of the type of a lox value, as reported by the type builtin
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *LoxArray:
+		return "array"
+	case *LoxMap:
+		return "map"
+	case LoxRange:
+		return "range"
+	case *LoxClass:
+		return "class"
+	case *LoxInstance:
+		return "instance"
+	case LoxCallable:
+		return "function"
+	}
+
+	return "unknown"
+}
+
+type InstanceOf struct{}
+
+func (InstanceOf) Arity() int {
+	return 2
+}
+
+func (InstanceOf) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	class, isClass := arguments[1].(*LoxClass)
+	if !isClass {
+		return nil, errors.New("second argument of instanceOf must be a class")
+	}
+
+	instance, isInstance := arguments[0].(*LoxInstance)
+	if !isInstance {
+		return false, nil
+	}
+
+	// walk up the inheritance chain looking for the class
+	for c := instance.Class; c != nil; c = c.Super {
+		if c == class {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (InstanceOf) Name() string {
+	return "instanceOf"
+}
+
+type ClassOf struct{}
+
+func (ClassOf) Arity() int {
+	return 1
+}
+
+func (ClassOf) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance, isInstance := arguments[0].(*LoxInstance)
+	if !isInstance {
+		return nil, errors.New("argument of classOf must be an instance")
+	}
+
+	return instance.Class, nil
+}
+
+func (ClassOf) Name() string {
+	return "classOf"
+}
+
+type Fields struct{}
+
+func (Fields) Arity() int {
+	return 1
+}
+
+func (Fields) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance, isInstance := arguments[0].(*LoxInstance)
+	if !isInstance {
+		return nil, errors.New("argument of fields must be an instance")
+	}
+
+	names := maps.Keys(instance.Fields)
+	sort.Strings(names)
+
+	fields := make([]any, len(names))
+	for i, name := range names {
+		fields[i] = name
+	}
+
+	return NewLoxArray(fields), nil
+}
+
+func (Fields) Name() string {
+	return "fields"
+}
+
+type Methods struct{}
+
+func (Methods) Arity() int {
+	return 1
+}
+
+func (Methods) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	class, isClass := arguments[0].(*LoxClass)
+	if !isClass {
+		return nil, errors.New("argument of methods must be a class")
+	}
+
+	// include inherited methods, but only list overridden methods once
+	seen := map[string]bool{}
+	for c := class; c != nil; c = c.Super {
+		for name := range c.Methods {
+			seen[name] = true
+		}
+	}
+
+	names := maps.Keys(seen)
+	sort.Strings(names)
+
+	methods := make([]any, len(names))
+	for i, name := range names {
+		methods[i] = name
+	}
+
+	return NewLoxArray(methods), nil
+}
+
+func (Methods) Name() string {
+	return "methods"
+}
+
+type GetField struct{}
+
+func (GetField) Arity() int {
+	return 2
+}
+
+func (GetField) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance, isInstance := arguments[0].(*LoxInstance)
+	name, isString := arguments[1].(string)
+
+	if !isInstance {
+		return nil, errors.New("first argument of getField must be an instance")
+	}
+
+	if !isString {
+		return nil, errors.New("second argument of getField must be a string")
+	}
+
+	value, ok := instance.Fields[name]
+	if !ok {
+		return nil, errors.New("Undefined field '" + name + "'.")
+	}
+
+	return value, nil
+}
+
+func (GetField) Name() string {
+	return "getField"
+}
+
+type SetField struct{}
+
+func (SetField) Arity() int {
+	return 3
+}
+
+func (SetField) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance, isInstance := arguments[0].(*LoxInstance)
+	name, isString := arguments[1].(string)
+
+	if !isInstance {
+		return nil, errors.New("first argument of setField must be an instance")
+	}
+
+	if !isString {
+		return nil, errors.New("second argument of setField must be a string")
+	}
+
+	if instance.Frozen {
+		return nil, errors.New("setField cannot modify a frozen instance")
+	}
+
+	instance.Fields[name] = arguments[2]
+	return arguments[2], nil
+}
+
+func (SetField) Name() string {
+	return "setField"
+}
+
+type HasField struct{}
+
+func (HasField) Arity() int {
+	return 2
+}
+
+func (HasField) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance, isInstance := arguments[0].(*LoxInstance)
+	name, isString := arguments[1].(string)
+
+	if !isInstance {
+		return nil, errors.New("first argument of hasField must be an instance")
+	}
+
+	if !isString {
+		return nil, errors.New("second argument of hasField must be a string")
+	}
+
+	_, ok := instance.Fields[name]
+	return ok, nil
+}
+
+func (HasField) Name() string {
+	return "hasField"
+}
+
+type Arity struct{}
+
+func (Arity) Arity() int {
+	return 1
+}
+
+func (Arity) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	function, isFunction := arguments[0].(LoxCallable)
+	if !isFunction {
+		return nil, errors.New("argument of arity must be a function or class")
+	}
+
+	return float64(function.Arity()), nil
+}
+
+func (Arity) Name() string {
+	return "arity"
+}
+
+type Doc struct{}
+
+func (Doc) Arity() int {
+	return 1
+}
+
+func (Doc) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	var doc string
+	switch val := arguments[0].(type) {
+	case *LoxFunction:
+		doc = val.declaration.Doc
+	case *LoxClass:
+		doc = val.Doc
+	case LoxCallable:
+		// natives have no doc comments
+	default:
+		return nil, errors.New("argument of doc must be a function or class")
+	}
+
+	if doc == "" {
+		return nil, nil
+	}
+	return doc, nil
+}
+
+func (Doc) Name() string {
+	return "doc"
+}
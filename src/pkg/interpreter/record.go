@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// newRecord creates an instance of a record class. Records are frozen as soon as they
+// are created, so their fields can only be changed by making a copy with with.
+func (c *LoxClass) newRecord(values []any) *LoxInstance {
+	instance := NewLoxInstance(c)
+	for i, field := range c.Fields {
+		instance.Fields[field] = values[i]
+	}
+	instance.Frozen = true
+	return instance
+}
+
+// recordEqual compares two instances of the same record class field by field
+func (i *Interpreter) recordEqual(left, right *LoxInstance, visiting map[comparison]bool) bool {
+	pair := comparison{left, right}
+	if left == right || visiting[pair] {
+		return true
+	}
+	visiting[pair] = true
+	defer delete(visiting, pair)
+
+	for _, field := range left.Class.Fields {
+		if !i.deepEqual(left.Fields[field], right.Fields[field], visiting) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordWith is the with method of records, which copies a record, replacing the
+// fields given in a map of field names to new values
+type recordWith struct{}
+
+func (recordWith) Arity() int {
+	return 2
+}
+
+func (recordWith) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	record := arguments[0].(*LoxInstance)
+	changes, isMap := arguments[1].(*LoxMap)
+	if !isMap {
+		return nil, errors.New("argument of with must be a map of field names to values")
+	}
+
+	values := make([]any, len(record.Class.Fields))
+	for i, field := range record.Class.Fields {
+		values[i] = record.Fields[field]
+	}
+
+	for _, pair := range changes.Pairs {
+		name, _ := pair.Key.(string)
+		position := slices.Index(record.Class.Fields, name)
+		if position < 0 {
+			return nil, errors.New(fmt.Sprintf("record %s has no field %s", record.Class.Name, Representation(pair.Key)))
+		}
+		values[position] = pair.Value
+	}
+
+	return record.Class.newRecord(values), nil
+}
@@ -0,0 +1,226 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hutcho66/glox/src/pkg/ast"
+)
+
+// formatter builds the string representation of values. Compound values that are
+// already being formatted are tracked in visiting, so cycles are shown as `...`
+// rather than recursing forever.
+type formatter struct {
+	interpreter *Interpreter
+	visiting    map[any]bool
+}
+
+// Representation is the default representation of a value, without calling any toString methods
+func Representation(v any) string {
+	f := &formatter{visiting: map[any]bool{}}
+	return f.format(v)
+}
+
+// PrintRepresentation is the same as Representation, except that strings are not quoted
+func PrintRepresentation(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return Representation(v)
+}
+
+// representation is the representation of a value, using the toString methods of any instances
+func (i *Interpreter) representation(v any) string {
+	f := &formatter{interpreter: i, visiting: i.formatting}
+	return f.format(v)
+}
+
+func (i *Interpreter) printRepresentation(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return i.representation(v)
+}
+
+// Stringify returns the representation of a value, reporting any runtime error raised by a toString method
+func (i *Interpreter) Stringify(v any) (representation string, ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ok = false
+		}
+	}()
+
+	return i.representation(v), true
+}
+
+// toStringMethod returns the toString method of an instance, or nil if its class doesn't define one
+func toStringMethod(instance *LoxInstance) *LoxFunction {
+	method := instance.Class.findMethod("toString")
+	if method == nil || method.declaration.Kind != ast.NORMAL_METHOD || method.Arity() != 0 {
+		return nil
+	}
+	return method
+}
+
+func (f *formatter) format(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("\"%s\"", v)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case float64:
+		return formatNumber(v)
+	case *LoxArray:
+		if !f.enter(v) {
+			return "[...]"
+		}
+		defer f.leave(v)
+
+		itemStrings := make([]string, len(v.Elements))
+		for i, item := range v.Elements {
+			itemStrings[i] = f.format(item)
+		}
+		return "[" + strings.Join(itemStrings, ", ") + "]"
+	case *LoxMap:
+		if !f.enter(v) {
+			return "{...}"
+		}
+		defer f.leave(v)
+
+		pairs := make([]MapPair, 0, len(v.Pairs))
+		for _, pair := range v.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+
+		pairStrings := make([]string, len(pairs))
+		for i, pair := range pairs {
+			pairStrings[i] = f.format(pair.Key) + ": " + f.format(pair.Value)
+		}
+		return "{" + strings.Join(pairStrings, ", ") + "}"
+	case LoxRange:
+		operator := ".."
+		if !v.Inclusive {
+			operator = "..<"
+		}
+		representation := f.format(v.Start) + operator + f.format(v.End)
+		if v.Step != 1 {
+			representation += " step " + f.format(v.Step)
+		}
+		return representation
+	case *LoxFunction:
+		if v.declaration.Name != nil {
+			return "<fn " + v.declaration.Name.Lexeme + ">"
+		} else {
+			return "<lambda>"
+		}
+	case *LoxClass:
+		return "<class " + v.Name + ">"
+	case *LoxInstance:
+		if !f.enter(v) {
+			if v.Class.Record {
+				return v.Class.Name + "(...)"
+			}
+			return v.Class.Name + " {...}"
+		}
+		defer f.leave(v)
+
+		if method := toStringMethod(v); method != nil && f.interpreter != nil {
+			return f.callToString(v, method)
+		}
+
+		if v.Class.Record {
+			fieldStrings := make([]string, len(v.Class.Fields))
+			for i, name := range v.Class.Fields {
+				fieldStrings[i] = name + ": " + f.format(v.Fields[name])
+			}
+			return v.Class.Name + "(" + strings.Join(fieldStrings, ", ") + ")"
+		}
+
+		names := make([]string, 0, len(v.Fields))
+		for name := range v.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fieldStrings := make([]string, len(names))
+		for i, name := range names {
+			fieldStrings[i] = name + ": " + f.format(v.Fields[name])
+		}
+		return v.Class.Name + " {" + strings.Join(fieldStrings, ", ") + "}"
+	case *BoundMethod:
+		return "<method " + v.name + " of " + typeName(v.Receiver) + ">"
+	case LoxNative:
+		return "<native fn " + v.Name() + ">"
+	}
+
+	return "<object>"
+}
+
+func (f *formatter) callToString(instance *LoxInstance, method *LoxFunction) string {
+	result, err := method.bind(instance).Call(f.interpreter, []any{})
+	if err != nil {
+		panic(f.interpreter.runtimeError(method.declaration.Name, err.Error()))
+	}
+
+	s, ok := result.(string)
+	if !ok {
+		panic(f.interpreter.runtimeError(method.declaration.Name, "toString must return a string"))
+	}
+	return s
+}
+
+// formatNumber writes numbers the way they can be written in source code. Very large and very
+// small numbers use exponent notation, e.g. 1e+21 and 1e-7, rather than printing every digit.
+func formatNumber(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	if magnitude := math.Abs(v); magnitude != 0 && (magnitude >= 1e21 || magnitude < 1e-6) {
+		mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(v, 'e', -1, 64), "e")
+		return mantissa + "e" + exponent[:1] + strings.TrimLeft(exponent[1:], "0")
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// keyLess orders map keys so maps print the same way every time. Keys of different types
+// are grouped by type, numbers and strings are ordered as usual and other keys by their representation.
+func keyLess(left, right any) bool {
+	if typeName(left) != typeName(right) {
+		return typeName(left) < typeName(right)
+	}
+
+	switch l := left.(type) {
+	case float64:
+		return l < right.(float64)
+	case string:
+		return l < right.(string)
+	}
+	return Representation(left) < Representation(right)
+}
+
+// enter marks a compound value as being formatted, returning false if it already is
+func (f *formatter) enter(v any) bool {
+	if f.visiting[v] {
+		return false
+	}
+	f.visiting[v] = true
+	return true
+}
+
+func (f *formatter) leave(v any) {
+	delete(f.visiting, v)
+}
@@ -1,9 +1,81 @@
 package interpreter
 
-type LoxArray []any
+// LoxArray is a mutable array. Arrays are shared by reference, so every variable,
+// field or element holding the same array sees changes made through any of them.
+type LoxArray struct {
+	Elements []any
+	Frozen   bool
+}
+
+func NewLoxArray(elements []any) *LoxArray {
+	if elements == nil {
+		elements = []any{}
+	}
+	return &LoxArray{Elements: elements}
+}
 
 type MapPair struct {
-	Key   string
+	Key   any
 	Value any
 }
-type LoxMap map[int]MapPair
+
+// LoxMap is a mutable map, keyed by the Hash of each key. Like arrays, maps are shared by reference.
+type LoxMap struct {
+	Pairs  map[int]MapPair
+	Frozen bool
+}
+
+func NewLoxMap(pairs map[int]MapPair) *LoxMap {
+	if pairs == nil {
+		pairs = map[int]MapPair{}
+	}
+	return &LoxMap{Pairs: pairs}
+}
+
+// LoxRange is a sequence of numbers from Start towards End, which is only
+// computed as it is iterated
+type LoxRange struct {
+	Start, End, Step float64
+	Inclusive        bool
+}
+
+// includes reports whether a value has not yet passed the end of the range
+func (r LoxRange) includes(value float64) bool {
+	if r.Inclusive && value == r.End {
+		return true
+	}
+	if r.Step > 0 {
+		return value < r.End
+	}
+	return value > r.End
+}
+
+// iterator returns a function that yields the elements of an array or range in turn,
+// ok is false if the value can't be iterated over
+func iterator(value any) (next func() (any, bool), ok bool) {
+	switch v := value.(type) {
+	case *LoxArray:
+		// the length is checked on every step, so elements pushed during iteration are visited
+		position := 0
+		return func() (any, bool) {
+			if position >= len(v.Elements) {
+				return nil, false
+			}
+			position++
+			return v.Elements[position-1], true
+		}, true
+	case LoxRange:
+		// multiply rather than accumulate to avoid compounding float errors
+		count := 0
+		return func() (any, bool) {
+			current := v.Start + float64(count)*v.Step
+			if !v.includes(current) {
+				return nil, false
+			}
+			count++
+			return current, true
+		}, true
+	}
+
+	return nil, false
+}
@@ -18,8 +18,8 @@ func (LoxReporter) Report(line int, where, message string) {
 }
 
 type LoxErrors struct {
-	hadScanningError, hadParsingError, hadResolutionError, hadRuntimeError bool
-	reporter                                                               Reporter
+	hadScanningError, hadParsingError, hadResolutionError, hadTypeError, hadRuntimeError bool
+	reporter                                                                             Reporter
 }
 
 func NewLoxErrors(reporter Reporter) *LoxErrors {
@@ -53,6 +53,17 @@ func (l *LoxErrors) ResolutionError(t *token.Token, message string) error {
 	return errors.New("")
 }
 
+func (l *LoxErrors) TypeError(t *token.Token, message string) error {
+	l.hadTypeError = true
+	if t.Type == token.EOF {
+		l.reporter.Report(t.Line, " at end", message)
+	} else {
+		l.reporter.Report(t.Line, " at '"+t.Lexeme+"'", message)
+	}
+
+	return errors.New("")
+}
+
 func (l *LoxErrors) RuntimeError(t *token.Token, message string) error {
 	l.hadRuntimeError = true
 	l.reporter.Report(t.Line, " at '"+t.Lexeme+"'", message)
@@ -75,9 +86,14 @@ func (l *LoxErrors) HadResolutionError() bool {
 	return l.hadResolutionError
 }
 
+func (l *LoxErrors) HadTypeError() bool {
+	return l.hadTypeError
+}
+
 func (l *LoxErrors) ResetError() {
 	l.hadScanningError = false
 	l.hadParsingError = false
 	l.hadRuntimeError = false
 	l.hadResolutionError = false
+	l.hadTypeError = false
 }
@@ -1,15 +1,21 @@
 package parser
 
 import (
+	"strings"
+
 	"github.com/hutcho66/glox/src/pkg/ast"
 	"github.com/hutcho66/glox/src/pkg/lox_error"
 	"github.com/hutcho66/glox/src/pkg/token"
 )
 
 type Parser struct {
-	errors  *lox_error.LoxErrors
-	tokens  []token.Token
-	current int
+	errors        *lox_error.LoxErrors
+	tokens        []token.Token
+	current, last int
+
+	// nesting is the number of brackets the parser is inside, where newlines are
+	// ignored as they can't end a statement. A block starts again from zero.
+	nesting int
 }
 
 func NewParser(tokens []token.Token, errors *lox_error.LoxErrors) *Parser {
@@ -35,6 +41,7 @@ func (p *Parser) declaration() (declaration ast.Statement) {
 	// catch any panics and synchronize to recover
 	defer func() {
 		if err := recover(); err != nil {
+			p.nesting = 0
 			p.synchronize()
 
 			// return nil for this statement
@@ -43,29 +50,82 @@ func (p *Parser) declaration() (declaration ast.Statement) {
 		}
 	}()
 
+	// doc comments are attached by the scanner to the first token of a declaration
+	doc := p.peek().Doc
+
+	if p.check(token.AT) {
+		return p.decoratedDeclaration(doc)
+	}
+
 	if p.match(token.VAR) {
-		return p.varDeclaration()
-	} else if p.match(token.CLASS) {
-		return p.classDeclaration()
+		statement := p.varDeclaration().(*ast.VarStatement)
+		statement.Doc = doc
+		return statement
+	} else if p.check(token.CLASS) && !p.checkAhead(token.LESS, 1) && !p.checkAhead(token.LEFT_BRACE, 1) {
+		// a class without a name is an anonymous class expression
+		p.advance()
+		statement := p.classDeclaration().(*ast.ClassStatement)
+		statement.Doc = doc
+		return statement
+	} else if p.match(token.RECORD) {
+		statement := p.recordDeclaration().(*ast.ClassStatement)
+		statement.Doc = doc
+		return statement
 	} else if p.match(token.FUN) {
-		return p.funDeclaration("function")
+		statement := p.funDeclaration("function").(*ast.FunctionStatement)
+		statement.Doc = doc
+		return statement
 	} else {
 		return p.statement()
 	}
 
 }
 
+func (p *Parser) decoratedDeclaration(doc string) ast.Statement {
+	decorators := p.decorators()
+
+	if p.match(token.CLASS) {
+		statement := p.classDeclaration().(*ast.ClassStatement)
+		statement.Doc = doc
+		statement.Decorators = decorators
+		return statement
+	} else if p.match(token.RECORD) {
+		statement := p.recordDeclaration().(*ast.ClassStatement)
+		statement.Doc = doc
+		statement.Decorators = decorators
+		return statement
+	} else if p.match(token.FUN) {
+		statement := p.funDeclaration("function").(*ast.FunctionStatement)
+		statement.Doc = doc
+		statement.Decorators = decorators
+		return statement
+	}
+
+	panic(p.errors.ParserError(p.peek(), "Decorators can only be applied to functions, methods and classes"))
+}
+
+func (p *Parser) decorators() []ast.Expression {
+	decorators := []ast.Expression{}
+	for p.match(token.AT) {
+		decorators = append(decorators, p.call_index())
+		p.eatNewLines()
+	}
+	return decorators
+}
+
 func (p *Parser) varDeclaration() ast.Statement {
 	name := p.consume(token.IDENTIFIER, "Expect variable name.")
+	varType := p.optionalTypeAnnotation()
 
 	var initializer ast.Expression = nil
 	if p.match(token.EQUAL) {
+		p.eatNewLines()
 		initializer = p.expression()
 	}
 
 	p.endStatement()
 
-	return &ast.VarStatement{Name: name, Initializer: initializer}
+	return &ast.VarStatement{Name: name, Initializer: initializer, Type: varType}
 }
 
 func (p *Parser) classDeclaration() ast.Statement {
@@ -78,33 +138,64 @@ func (p *Parser) classDeclaration() ast.Statement {
 	}
 
 	p.consume(token.LEFT_BRACE, "Exepct '{' before class body.")
+	methods, fields := p.classBody()
+
+	return &ast.ClassStatement{Name: name, Methods: methods, Superclass: super, Fields: fields}
+}
+
+// recordDeclaration parses a record, a class whose fields are given by its parameters
+// and that can have a body of methods
+func (p *Parser) recordDeclaration() ast.Statement {
+	name := p.consume(token.IDENTIFIER, "Expect record name.")
+
+	p.consume(token.LEFT_PAREN, "Expect '(' after record name.")
+	p.nesting++
+	parameters, parameterTypes := p.parameters()
+	p.consume(token.RIGHT_PAREN, "Expect ')' after record fields.")
+	p.nesting--
+
+	fields := make([]*ast.FieldDeclaration, len(parameters))
+	for i := range parameters {
+		fields[i] = &ast.FieldDeclaration{Name: parameters[i], Type: parameterTypes[i]}
+	}
 
 	methods := []*ast.FunctionStatement{}
+	if p.match(token.LEFT_BRACE) {
+		var bodyFields []*ast.FieldDeclaration
+		methods, bodyFields = p.classBody()
+		if len(bodyFields) > 0 {
+			panic(p.errors.ParserError(bodyFields[0].Name, "Record fields must be declared in its parameter list"))
+		}
+	} else {
+		p.endStatement()
+	}
+
+	return &ast.ClassStatement{Name: name, Methods: methods, Fields: fields, Record: true}
+}
+
+// classBody parses the methods and field declarations of a class, up to and including its closing brace
+func (p *Parser) classBody() ([]*ast.FunctionStatement, []*ast.FieldDeclaration) {
+	defer p.resetNesting()()
+
+	methods := []*ast.FunctionStatement{}
+	fields := []*ast.FieldDeclaration{}
 	p.eatNewLines()
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
-		if p.match(token.GET) {
-			// this is a getter
-			name := p.consume(token.IDENTIFIER, "Expect getter name.")
-			p.consume(token.LEFT_BRACE, "Expect '{' after getter name")
-
-			body := p.block()
-			getter := &ast.FunctionStatement{Name: name, Params: []*token.Token{}, Body: body, Kind: ast.GETTER_METHOD}
-			methods = append(methods, getter)
-		} else if p.match(token.SET) {
-			name := p.consume(token.IDENTIFIER, "Expect setter name.")
-			p.consume(token.LEFT_PAREN, "Expect '(' after setter name.")
-			value := p.consume(token.IDENTIFIER, "Expect parameter name.")
-			p.consume(token.RIGHT_PAREN, "Expect ')' after setter parameter")
-
-			p.consume(token.LEFT_BRACE, "Expect '{' before setter body.")
-
-			body := p.block()
-
-			setter := &ast.FunctionStatement{Name: name, Params: []*token.Token{value}, Body: body, Kind: ast.SETTER_METHOD}
-			methods = append(methods, setter)
+		doc := p.peek().Doc
+		decorators := p.decorators()
+
+		if p.check(token.IDENTIFIER) && p.checkAhead(token.COLON, 1) {
+			// this is a field declaration, which only exists to annotate the field's type
+			name := p.advance()
+			if len(decorators) > 0 {
+				panic(p.errors.ParserError(name, "Decorators can only be applied to functions, methods and classes"))
+			}
+			fieldType := p.optionalTypeAnnotation()
+			p.endStatement()
+
+			fields = append(fields, &ast.FieldDeclaration{Name: name, Type: fieldType})
 		} else {
-			method := p.funDeclaration("method").(*ast.FunctionStatement)
-			methods = append(methods, method)
+			methods = append(methods, p.method(doc, decorators))
 		}
 
 		p.eatNewLines()
@@ -112,7 +203,99 @@ func (p *Parser) classDeclaration() ast.Statement {
 
 	p.consume(token.RIGHT_BRACE, "Expect '}' after class body.")
 
-	return &ast.ClassStatement{Name: name, Methods: methods, Superclass: super}
+	return methods, fields
+}
+
+// method parses a method, getter or setter of a class or object literal
+func (p *Parser) method(doc string, decorators []ast.Expression) *ast.FunctionStatement {
+	if p.match(token.GET) {
+		// this is a getter
+		name := p.consume(token.IDENTIFIER, "Expect getter name.")
+		returnType := p.optionalTypeAnnotation()
+		p.consume(token.LEFT_BRACE, "Expect '{' after getter name")
+
+		body := p.block()
+		return &ast.FunctionStatement{Name: name, Params: []*token.Token{}, Body: body, Kind: ast.GETTER_METHOD, Doc: doc, ParamTypes: []*ast.TypeAnnotation{}, ReturnType: returnType, Decorators: decorators}
+	}
+
+	if p.match(token.SET) {
+		name := p.consume(token.IDENTIFIER, "Expect setter name.")
+		p.consume(token.LEFT_PAREN, "Expect '(' after setter name.")
+		value := p.consume(token.IDENTIFIER, "Expect parameter name.")
+		valueType := p.optionalTypeAnnotation()
+		p.consume(token.RIGHT_PAREN, "Expect ')' after setter parameter")
+
+		p.consume(token.LEFT_BRACE, "Expect '{' before setter body.")
+
+		body := p.block()
+		return &ast.FunctionStatement{Name: name, Params: []*token.Token{value}, Body: body, Kind: ast.SETTER_METHOD, Doc: doc, ParamTypes: []*ast.TypeAnnotation{valueType}, Decorators: decorators}
+	}
+
+	method := p.funDeclaration("method").(*ast.FunctionStatement)
+	method.Doc = doc
+	method.Decorators = decorators
+	return method
+}
+
+// classExpression parses an anonymous class, the class keyword has already been consumed
+func (p *Parser) classExpression() ast.Expression {
+	keyword := p.previous()
+
+	var super *ast.VariableExpression = nil
+	if p.match(token.LESS) {
+		p.consume(token.IDENTIFIER, "Expect superclass name.")
+		super = &ast.VariableExpression{Name: p.previous()}
+	}
+
+	p.consume(token.LEFT_BRACE, "Exepct '{' before class body.")
+	methods, fields := p.classBody()
+
+	name := &token.Token{Type: token.IDENTIFIER, Lexeme: "anonymous", Line: keyword.Line}
+	class := &ast.ClassStatement{Name: name, Methods: methods, Superclass: super, Fields: fields}
+	return &ast.ClassExpression{Keyword: keyword, Class: class}
+}
+
+// objectExpression parses an object literal, whose members are fields given a value
+// and methods, separated by commas or newlines. The object keyword has already been consumed.
+func (p *Parser) objectExpression() ast.Expression {
+	keyword := p.previous()
+	p.consume(token.LEFT_BRACE, "Expect '{' after 'object'.")
+	defer p.resetNesting()()
+
+	fields := []*token.Token{}
+	values := []ast.Expression{}
+	methods := []*ast.FunctionStatement{}
+
+	p.eatNewLines()
+	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
+		doc := p.peek().Doc
+		decorators := p.decorators()
+
+		if p.check(token.IDENTIFIER) && p.checkAhead(token.COLON, 1) {
+			name := p.advance()
+			if len(decorators) > 0 {
+				panic(p.errors.ParserError(name, "Decorators can only be applied to functions, methods and classes"))
+			}
+			p.consume(token.COLON, "Expect ':' after field name.")
+			fields = append(fields, name)
+			values = append(values, p.expression())
+
+			if !p.check(token.RIGHT_BRACE) && !p.check(token.COMMA) && !p.check(token.NEW_LINE) && !p.isAtEnd() {
+				panic(p.errors.ParserError(p.peek(), "Expect ',' or newline after object field."))
+			}
+		} else {
+			methods = append(methods, p.method(doc, decorators))
+		}
+
+		p.match(token.COMMA)
+		p.eatNewLines()
+	}
+
+	p.consume(token.RIGHT_BRACE, "Expect '}' after object literal.")
+
+	name := &token.Token{Type: token.IDENTIFIER, Lexeme: "object", Line: keyword.Line}
+	class := &ast.ClassStatement{Name: name, Methods: methods}
+	return &ast.ObjectExpression{Keyword: keyword, Fields: fields, Values: values, Class: class}
 }
 
 func (p *Parser) funDeclaration(kind string) ast.Statement {
@@ -125,7 +308,48 @@ func (p *Parser) funDeclaration(kind string) ast.Statement {
 
 	name := p.consume(token.IDENTIFIER, "Expect "+kind+" name")
 	p.consume(token.LEFT_PAREN, "Expect '(' after "+kind+" name")
+	p.nesting++
+	parameters, parameterTypes := p.parameters()
+	p.consume(token.RIGHT_PAREN, "Expect ')' after parameters")
+	p.nesting--
+	returnType := p.optionalTypeAnnotation()
+	requires, ensures := p.contract()
+
+	p.consume(token.LEFT_BRACE, "Expect '{' before "+kind+" body")
+	body := p.block()
+
+	return &ast.FunctionStatement{Name: name, Params: parameters, Body: body, Kind: methodKind, ParamTypes: parameterTypes, ReturnType: returnType, Requires: requires, Ensures: ensures}
+}
+
+// contract parses the requires and ensures clauses between the parameters and body of a
+// function. The words are only special here, and each clause can be on its own line.
+func (p *Parser) contract() (requires, ensures []*ast.AssertStatement) {
+	for {
+		position := p.current
+		for position < len(p.tokens) && p.tokens[position].Type == token.NEW_LINE {
+			position++
+		}
+		next := p.tokens[position]
+		if next.Type != token.IDENTIFIER || (next.Lexeme != "requires" && next.Lexeme != "ensures") {
+			return requires, ensures
+		}
+
+		p.current = position
+		keyword := p.advance()
+		if keyword.Lexeme == "requires" {
+			requires = append(requires, p.assertion(keyword))
+		} else {
+			ensures = append(ensures, p.assertion(keyword))
+		}
+
+		// the body can start on the line after the last clause
+		p.eatNewLines()
+	}
+}
+
+func (p *Parser) parameters() ([]*token.Token, []*ast.TypeAnnotation) {
 	parameters := []*token.Token{}
+	parameterTypes := []*ast.TypeAnnotation{}
 	if !p.check(token.RIGHT_PAREN) {
 		for ok := true; ok; ok = p.match(token.COMMA) {
 			p.eatNewLines()
@@ -134,14 +358,39 @@ func (p *Parser) funDeclaration(kind string) ast.Statement {
 			}
 
 			parameters = append(parameters, p.consume(token.IDENTIFIER, "Expect parameter name"))
+			parameterTypes = append(parameterTypes, p.optionalTypeAnnotation())
 		}
 	}
-	p.consume(token.RIGHT_PAREN, "Expect ')' after parameters")
 
-	p.consume(token.LEFT_BRACE, "Expect '{' before "+kind+" body")
-	body := p.block()
+	return parameters, parameterTypes
+}
 
-	return &ast.FunctionStatement{Name: name, Params: parameters, Body: body, Kind: methodKind}
+func (p *Parser) optionalTypeAnnotation() *ast.TypeAnnotation {
+	if p.match(token.COLON) {
+		return p.typeAnnotation()
+	}
+	return nil
+}
+
+func (p *Parser) typeAnnotation() *ast.TypeAnnotation {
+	var name *token.Token
+	if p.match(token.NIL) {
+		name = p.previous()
+	} else {
+		name = p.consume(token.IDENTIFIER, "Expect type name")
+	}
+
+	arguments := []*ast.TypeAnnotation{}
+	if p.match(token.LESS) {
+		for ok := true; ok; ok = p.match(token.COMMA) {
+			arguments = append(arguments, p.typeAnnotation())
+		}
+		p.consume(token.GREATER, "Expect '>' after type arguments")
+	}
+
+	nullable := p.match(token.QUESTION)
+
+	return &ast.TypeAnnotation{Name: name, Arguments: arguments, Nullable: nullable}
 }
 
 func (p *Parser) statement() ast.Statement {
@@ -162,20 +411,35 @@ func (p *Parser) statement() ast.Statement {
 		return p.continueStatement()
 	}
 
+	if p.match(token.DEFER) {
+		return p.deferStatement()
+	}
+
+	if p.match(token.ASSERT) {
+		return p.assertStatement()
+	}
+
 	if p.match(token.IF) {
 		return p.ifStatement()
 	}
 
 	if p.match(token.WHILE) {
-		return p.whileStatement()
+		return p.whileStatement(nil)
 	}
 
 	if p.match(token.FOR) {
-		return p.forStatement()
+		return p.forStatement(nil)
+	}
+
+	if p.check(token.IDENTIFIER) && p.checkAhead(token.COLON, 1) {
+		return p.labeledStatement()
 	}
 
 	if p.check(token.LEFT_BRACE) {
-		if p.checkAhead(token.RIGHT_BRACE, 1) || (p.checkAhead(token.STRING, 1) && p.checkAhead(token.COLON, 2)) {
+		if p.checkAhead(token.RIGHT_BRACE, 1) || p.checkAhead(token.DOT_DOT_DOT, 1) || (p.checkAhead(token.STRING, 1) && p.checkAhead(token.COLON, 2)) ||
+			(p.checkAhead(token.NUMBER, 1) && p.checkAhead(token.COLON, 2)) ||
+			(p.checkAhead(token.IDENTIFIER, 1) && p.checkAhead(token.COLON, 2) && !p.checkAhead(token.WHILE, 3) && !p.checkAhead(token.FOR, 3)) {
+			// `{ IDENT :` is a map unless it is a labeled loop
 			// this looks like a map
 			return p.expressionStatement()
 		}
@@ -187,6 +451,8 @@ func (p *Parser) statement() ast.Statement {
 }
 
 func (p *Parser) block() []ast.Statement {
+	defer p.resetNesting()()
+
 	statements := []ast.Statement{}
 
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
@@ -213,20 +479,97 @@ func (p *Parser) returnStatement() ast.Statement {
 
 func (p *Parser) breakStatement() ast.Statement {
 	keyword := p.previous()
+	var label *token.Token = nil
+	if p.match(token.IDENTIFIER) {
+		label = p.previous()
+	}
 	p.endStatement()
-	return &ast.BreakStatement{Keyword: keyword}
+	return &ast.BreakStatement{Keyword: keyword, Label: label}
 }
 
 func (p *Parser) continueStatement() ast.Statement {
 	keyword := p.previous()
+	var label *token.Token = nil
+	if p.match(token.IDENTIFIER) {
+		label = p.previous()
+	}
+	p.endStatement()
+	return &ast.ContinueStatement{Keyword: keyword, Label: label}
+}
+
+func (p *Parser) deferStatement() ast.Statement {
+	keyword := p.previous()
+	call, ok := p.expression().(*ast.CallExpression)
+	if !ok {
+		panic(p.errors.ParserError(keyword, "Expect a call after 'defer'"))
+	}
+
 	p.endStatement()
-	return &ast.ContinueStatement{Keyword: keyword}
+	return &ast.DeferStatement{Keyword: keyword, Call: call}
+}
+
+func (p *Parser) assertStatement() ast.Statement {
+	statement := p.assertion(p.previous())
+	p.endStatement()
+	return statement
+}
+
+// assertion parses a condition and an optional message, separated by a comma
+func (p *Parser) assertion(keyword *token.Token) *ast.AssertStatement {
+	start := p.skipNewLines(p.current)
+	condition := p.expression()
+	source := p.sourceText(start, p.last)
+
+	var message ast.Expression = nil
+	if p.match(token.COMMA) {
+		p.eatNewLines()
+		message = p.expression()
+	}
+
+	return &ast.AssertStatement{Keyword: keyword, Condition: condition, Message: message, Source: source}
+}
+
+// sourceText rebuilds the source of the tokens from start to end, with any
+// whitespace between them, including newlines, shown as a single space
+func (p *Parser) sourceText(start, end int) string {
+	var text strings.Builder
+	spaced := false
+	for _, t := range p.tokens[start : end+1] {
+		if t.Type == token.NEW_LINE {
+			spaced = true
+			continue
+		}
+		if text.Len() > 0 && (spaced || t.Spaced) {
+			text.WriteString(" ")
+		}
+		text.WriteString(t.Lexeme)
+		spaced = false
+	}
+	return text.String()
+}
+
+func (p *Parser) labeledStatement() ast.Statement {
+	label := p.advance()
+	p.consume(token.COLON, "Expect ':' after label")
+	p.eatNewLines()
+
+	if p.match(token.WHILE) {
+		return p.whileStatement(label)
+	}
+
+	if p.match(token.FOR) {
+		return p.forStatement(label)
+	}
+
+	panic(p.errors.ParserError(p.peek(), "Only loops can be labeled"))
 }
 
 func (p *Parser) ifStatement() ast.Statement {
 	p.consume(token.LEFT_PAREN, "Expect '(' after 'if'")
+	p.nesting++
 	condition := p.expression()
 	p.consume(token.RIGHT_PAREN, "Expect ')' after if condition")
+	p.nesting--
 	consequence := p.statement()
 
 	var alternative ast.Statement = nil
@@ -237,19 +580,22 @@ func (p *Parser) ifStatement() ast.Statement {
 	return &ast.IfStatement{Condition: condition, Consequence: consequence, Alternative: alternative}
 }
 
-func (p *Parser) whileStatement() ast.Statement {
+func (p *Parser) whileStatement(label *token.Token) ast.Statement {
 	p.consume(token.LEFT_PAREN, "Expect '(' after 'while'")
+	p.nesting++
 	condition := p.expression()
 	p.consume(token.RIGHT_PAREN, "Expect ')' after while condition")
+	p.nesting--
 
 	body := p.statement()
 
 	// while statements have no increment
-	return &ast.LoopStatement{Condition: condition, Body: body, Increment: nil}
+	return &ast.LoopStatement{Condition: condition, Body: body, Increment: nil, Label: label}
 }
 
-func (p *Parser) forStatement() ast.Statement {
+func (p *Parser) forStatement(label *token.Token) ast.Statement {
 	p.consume(token.LEFT_PAREN, "Expect '(' after 'for'")
+	p.nesting++
 
 	if p.check(token.VAR) && p.checkAhead(token.OF, 2) {
 		// for (IDENT of ARRAY)format
@@ -258,10 +604,11 @@ func (p *Parser) forStatement() ast.Statement {
 		p.consume(token.OF, "Expect 'of' after variable name")
 		array := p.expression()
 		p.consume(token.RIGHT_PAREN, "Expect ')' after for clauses")
+		p.nesting--
 
 		body := p.statement()
 
-		return &ast.ForEachStatement{VariableName: name, Array: array, Body: body}
+		return &ast.ForEachStatement{VariableName: name, Array: array, Body: body, Label: label}
 	}
 
 	// else continue with c-style loop
@@ -285,6 +632,7 @@ func (p *Parser) forStatement() ast.Statement {
 		increment = p.expression()
 	}
 	p.consume(token.RIGHT_PAREN, "Expect ')' after for clauses")
+	p.nesting--
 
 	body := p.statement()
 
@@ -293,7 +641,8 @@ func (p *Parser) forStatement() ast.Statement {
 		condition = &ast.LiteralExpression{Value: true}
 	}
 	// create LoopStatement using condition, body and increment
-	body = &ast.LoopStatement{Condition: condition, Body: body, Increment: increment}
+	_, declaresVariables := initializer.(*ast.VarStatement)
+	body = &ast.LoopStatement{Condition: condition, Body: body, Increment: increment, Label: label, PerIteration: declaresVariables}
 
 	// if there is an initializer, add before loop statement
 	if initializer != nil {
@@ -323,9 +672,9 @@ func (p *Parser) expression() ast.Expression {
 		}
 
 		if p.checkAhead(token.IDENTIFIER, 1) {
-			// presence of comma indicates a lambda
+			// presence of comma or type annotation indicates a lambda
 			// as does a right paren and then the arrow operator
-			if p.checkAhead(token.COMMA, 2) || p.checkAhead(token.RIGHT_PAREN, 2) && p.checkAhead(token.LAMBDA_ARROW, 3) {
+			if p.checkAhead(token.COMMA, 2) || p.checkAhead(token.COLON, 2) || p.checkAhead(token.RIGHT_PAREN, 2) && p.checkAhead(token.LAMBDA_ARROW, 3) {
 				return p.lambda()
 			}
 		}
@@ -340,30 +689,27 @@ func (p *Parser) expression() ast.Expression {
 }
 
 func (p *Parser) lambda() ast.Expression {
-	parameters := []*token.Token{}
+	var (
+		parameters     []*token.Token
+		parameterTypes []*ast.TypeAnnotation
+	)
 	if p.match(token.IDENTIFIER) {
 		// x => <expression> form
-		parameters = append(parameters, p.previous())
+		parameters = []*token.Token{p.previous()}
+		parameterTypes = []*ast.TypeAnnotation{nil}
 	} else {
 		p.consume(token.LEFT_PAREN, "unexpected error") // already checked
-
-		if !p.check(token.RIGHT_PAREN) {
-			for ok := true; ok; ok = p.match(token.COMMA) {
-				p.eatNewLines()
-				if len(parameters) >= 255 {
-					panic(p.errors.ParserError(p.peek(), "Can't have more than 255 parameters"))
-				}
-				parameters = append(parameters, p.consume(token.IDENTIFIER, "Expect parameter name"))
-			}
-		}
-
+		p.nesting++
+		parameters, parameterTypes = p.parameters()
 		p.consume(token.RIGHT_PAREN, "Expect ')' after parameters")
+		p.nesting--
 	}
 
 	operator := p.consume(token.LAMBDA_ARROW, "Expect '=>' after lambda parameters")
+	p.eatNewLines()
 
 	var body []ast.Statement
-	if !p.check(token.LEFT_BRACE) || (p.checkAhead(token.STRING, 1) && p.checkAhead(token.COLON, 2)) {
+	if !p.check(token.LEFT_BRACE) || p.checkAhead(token.DOT_DOT_DOT, 1) || ((p.checkAhead(token.STRING, 1) || p.checkAhead(token.NUMBER, 1)) && p.checkAhead(token.COLON, 2)) {
 		// this is an expression return lambda
 		line := p.peek().Line
 		expression := p.expression()
@@ -378,7 +724,7 @@ func (p *Parser) lambda() ast.Expression {
 		body = p.block()
 	}
 
-	function := &ast.FunctionStatement{Name: nil, Params: parameters, Body: body}
+	function := &ast.FunctionStatement{Name: nil, Params: parameters, Body: body, ParamTypes: parameterTypes}
 
 	return &ast.LambdaExpression{Operator: operator, Function: function}
 }
@@ -388,8 +734,10 @@ func (p *Parser) ternary() ast.Expression {
 
 	if p.match(token.QUESTION) {
 		operator := p.previous()
+		p.eatNewLines()
 		consequence := p.expression()
 		p.consume(token.COLON, "Expect ':' after expression following '?'")
+		p.eatNewLines()
 		alternative := p.expression()
 
 		return &ast.TernaryExpression{Condition: condition, Consequence: consequence, Alternative: alternative, Operator: operator}
@@ -399,10 +747,11 @@ func (p *Parser) ternary() ast.Expression {
 }
 
 func (p *Parser) assignment() ast.Expression {
-	expr := p.or()
+	expr := p.pipeline()
 
 	if p.match(token.EQUAL) {
 		equals := p.previous()
+		p.eatNewLines()
 		value := p.assignment()
 
 		switch e := expr.(type) {
@@ -413,9 +762,6 @@ func (p *Parser) assignment() ast.Expression {
 		case *ast.SuperGetExpression:
 			return &ast.SuperSetExpression{Keyword: e.Keyword, Method: e.Method, Value: value}
 		case *ast.IndexExpression:
-			if e.RightIndex != nil {
-				panic(p.errors.ParserError(equals, "Cannot assign to array slice"))
-			}
 			return &ast.IndexedAssignmentExpression{Left: e, Value: value}
 		}
 
@@ -425,11 +771,48 @@ func (p *Parser) assignment() ast.Expression {
 	return expr
 }
 
+func (p *Parser) pipeline() ast.Expression {
+	expr := p.or()
+
+	for p.match(token.PIPELINE) || p.matchOnNextLine(token.PIPELINE) {
+		operator := p.previous()
+		p.eatNewLines()
+		right := p.or()
+
+		call, ok := right.(*ast.CallExpression)
+		if !ok {
+			// a plain function is called with the left value as its only argument
+			expr = &ast.PipelineExpression{Left: expr, Callee: right, Arguments: []ast.Expression{nil}, Operator: operator}
+			continue
+		}
+
+		// the left value replaces any `_` placeholder arguments, or else becomes the first argument
+		arguments := []ast.Expression{}
+		hasPlaceholder := false
+		for _, argument := range call.Arguments {
+			if variable, ok := argument.(*ast.VariableExpression); ok && variable.Name.Lexeme == "_" {
+				arguments = append(arguments, nil)
+				hasPlaceholder = true
+			} else {
+				arguments = append(arguments, argument)
+			}
+		}
+		if !hasPlaceholder {
+			arguments = append([]ast.Expression{nil}, arguments...)
+		}
+
+		expr = &ast.PipelineExpression{Left: expr, Callee: call.Callee, Arguments: arguments, Operator: operator}
+	}
+
+	return expr
+}
+
 func (p *Parser) or() ast.Expression {
 	expr := p.and()
 
 	for p.match(token.OR) {
 		operator := p.previous()
+		p.eatNewLines()
 		right := p.and()
 
 		expr = &ast.LogicalExpression{Left: expr, Right: right, Operator: operator}
@@ -443,6 +826,7 @@ func (p *Parser) and() ast.Expression {
 
 	for p.match(token.AND) {
 		operator := p.previous()
+		p.eatNewLines()
 		right := p.equality()
 
 		expr = &ast.LogicalExpression{Left: expr, Right: right, Operator: operator}
@@ -456,6 +840,7 @@ func (p *Parser) equality() ast.Expression {
 
 	for p.match(token.BANG_EQUAL, token.EQUAL_EQUAL) {
 		operator := p.previous()
+		p.eatNewLines()
 		right := p.comparison()
 
 		expr = &ast.BinaryExpression{Left: expr, Right: right, Operator: operator}
@@ -465,23 +850,70 @@ func (p *Parser) equality() ast.Expression {
 }
 
 func (p *Parser) comparison() ast.Expression {
-	expr := p.term()
+	expr := p.membership()
 
 	for p.match(token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL) {
 		operator := p.previous()
-		right := p.term()
+		p.eatNewLines()
+		right := p.membership()
+
+		expr = &ast.BinaryExpression{Left: expr, Right: right, Operator: operator}
+	}
+
+	return expr
+}
+
+func (p *Parser) membership() ast.Expression {
+	expr := p.rangeExpression()
 
+	for {
+		var operator *token.Token
+		if p.match(token.IN) {
+			operator = p.previous()
+		} else if p.check(token.IDENTIFIER) && p.peek().Lexeme == "not" && p.checkAhead(token.IN, 1) {
+			// not is not a reserved word, it is only special before in
+			not := p.advance()
+			p.advance()
+			operator = &token.Token{Type: token.NOT_IN, Lexeme: "not in", Line: not.Line}
+		} else {
+			break
+		}
+
+		p.eatNewLines()
+		right := p.rangeExpression()
 		expr = &ast.BinaryExpression{Left: expr, Right: right, Operator: operator}
 	}
 
 	return expr
 }
 
+func (p *Parser) rangeExpression() ast.Expression {
+	expr := p.term()
+
+	if p.match(token.DOT_DOT, token.DOT_DOT_LESS) {
+		operator := p.previous()
+		p.eatNewLines()
+		end := p.term()
+
+		// step is not a reserved word, it is only special following a range
+		var step ast.Expression
+		if p.check(token.IDENTIFIER) && p.peek().Lexeme == "step" {
+			p.advance()
+			step = p.term()
+		}
+
+		return &ast.RangeExpression{Start: expr, End: end, Step: step, Inclusive: operator.Type == token.DOT_DOT, Operator: operator}
+	}
+
+	return expr
+}
+
 func (p *Parser) term() ast.Expression {
 	expr := p.factor()
 
 	for p.match(token.MINUS, token.PLUS) {
 		operator := p.previous()
+		p.eatNewLines()
 		right := p.factor()
 		expr = &ast.BinaryExpression{Left: expr, Right: right, Operator: operator}
 	}
@@ -494,6 +926,7 @@ func (p *Parser) factor() ast.Expression {
 
 	for p.match(token.SLASH, token.STAR) {
 		operator := p.previous()
+		p.eatNewLines()
 		right := p.unary()
 		expr = &ast.BinaryExpression{Left: expr, Right: right, Operator: operator}
 	}
@@ -519,7 +952,9 @@ func (p *Parser) call_index() ast.Expression {
 			expr = p.finishCall(expr)
 		} else if p.match(token.LEFT_BRACKET) {
 			expr = p.finishIndex(expr)
-		} else if p.match(token.DOT) {
+		} else if p.match(token.DOT) || p.matchOnNextLine(token.DOT) {
+			// a chain of calls can be split over lines before or after each '.'
+			p.eatNewLines()
 			name := p.consume(token.IDENTIFIER, "Expect property name after '.'")
 			expr = &ast.GetExpression{Object: expr, Name: name}
 		} else {
@@ -543,9 +978,17 @@ func (p *Parser) primary() ast.Expression {
 	if p.match(token.NUMBER, token.STRING) {
 		return &ast.LiteralExpression{Value: p.previous().Literal}
 	}
+	if p.check(token.IDENTIFIER) && p.peek().Lexeme == "object" && p.checkAhead(token.LEFT_BRACE, 1) {
+		// object is only a keyword when it starts an object literal
+		p.advance()
+		return p.objectExpression()
+	}
 	if p.match(token.IDENTIFIER) {
 		return &ast.VariableExpression{Name: p.previous()}
 	}
+	if p.match(token.CLASS) {
+		return p.classExpression()
+	}
 	if p.match(token.THIS) {
 		return &ast.ThisExpression{Keyword: p.previous()}
 	}
@@ -556,12 +999,15 @@ func (p *Parser) primary() ast.Expression {
 		return &ast.SuperGetExpression{Keyword: keyword, Method: method}
 	}
 	if p.match(token.LEFT_PAREN) {
+		p.nesting++
 		if p.match(token.RIGHT_PAREN) {
 			// empty sequence expression
+			p.nesting--
 			return &ast.SequenceExpression{Items: []ast.Expression{}}
 		}
 		exprs := p.expressionList()
 		p.consume(token.RIGHT_PAREN, "Expect ')' after expression")
+		p.nesting--
 
 		if len(exprs) == 1 {
 			return &ast.GroupingExpression{Expr: exprs[0]}
@@ -570,37 +1016,62 @@ func (p *Parser) primary() ast.Expression {
 		}
 	}
 	if p.match(token.LEFT_BRACKET) {
+		openingBracket := p.previous()
+		p.nesting++
 		if p.match(token.RIGHT_BRACKET) {
 			// empty array
+			p.nesting--
 			return &ast.ArrayExpression{Items: []ast.Expression{}}
 		}
-		exprs := p.expressionList()
+		exprs := p.elementList()
+
+		if _, spread := exprs[0].(*ast.SpreadExpression); len(exprs) == 1 && !spread && p.check(token.FOR) {
+			clauses := p.comprehensionClauses()
+			p.consume(token.RIGHT_BRACKET, "Expect ']' after array comprehension")
+			p.nesting--
+			return &ast.ComprehensionExpression{Opening: openingBracket, Value: exprs[0], Clauses: clauses}
+		}
 		p.consume(token.RIGHT_BRACKET, "Expect ']' after array literal")
+		p.nesting--
 
 		return &ast.ArrayExpression{Items: exprs}
 	}
 	if p.match(token.LEFT_BRACE) {
 		openingBrace := p.previous()
-		// eat any newlines, they are allowed before first key-pair
-		p.eatNewLines()
+		p.nesting++
 
 		if p.match(token.RIGHT_BRACE) {
-			// empty array
+			// empty map
+			p.nesting--
 			return &ast.MapExpression{OpeningBrace: openingBrace, Keys: []ast.Expression{}, Values: []ast.Expression{}}
 		}
 
 		keys := []ast.Expression{}
 		values := []ast.Expression{}
+
 		for ok := true; ok; ok = p.match(token.COMMA) {
 			p.eatNewLines()
 
-			keys = append(keys, p.expression())
-			p.consume(token.COLON, "Expect ':' between key and value in map literal")
-			values = append(values, p.expression())
+			if p.match(token.DOT_DOT_DOT) {
+				keys = append(keys, &ast.SpreadExpression{Operator: p.previous(), Expr: p.expression()})
+				values = append(values, nil)
+			} else {
+				keys = append(keys, p.expression())
+				p.consume(token.COLON, "Expect ':' between key and value in map literal")
+				values = append(values, p.expression())
+			}
 
 			p.eatNewLines()
+
+			if _, spread := keys[0].(*ast.SpreadExpression); len(keys) == 1 && !spread && p.check(token.FOR) {
+				clauses := p.comprehensionClauses()
+				p.consume(token.RIGHT_BRACE, "Expect '}' after map comprehension")
+				p.nesting--
+				return &ast.ComprehensionExpression{Opening: openingBrace, Key: keys[0], Value: values[0], Clauses: clauses}
+			}
 		}
 		p.consume(token.RIGHT_BRACE, "Expect '}' after map literal")
+		p.nesting--
 
 		return &ast.MapExpression{OpeningBrace: openingBrace, Keys: keys, Values: values}
 	}
@@ -608,6 +1079,27 @@ func (p *Parser) primary() ast.Expression {
 	panic(p.errors.ParserError(p.peek(), "Expect expression."))
 }
 
+func (p *Parser) comprehensionClauses() []*ast.ComprehensionClause {
+	clauses := []*ast.ComprehensionClause{}
+
+	// the first clause is always a for clause
+	for p.check(token.FOR) || (len(clauses) > 0 && p.check(token.IF)) {
+		if p.match(token.FOR) {
+			variable := p.consume(token.IDENTIFIER, "Expect variable name after 'for'")
+			p.consume(token.OF, "Expect 'of' after variable name")
+			iterable := p.expression()
+			clauses = append(clauses, &ast.ComprehensionClause{Variable: variable, Iterable: iterable})
+		} else {
+			p.match(token.IF)
+			condition := p.expression()
+			clauses = append(clauses, &ast.ComprehensionClause{Condition: condition})
+		}
+		p.eatNewLines()
+	}
+
+	return clauses
+}
+
 func (p *Parser) expressionList() []ast.Expression {
 	// eat any newlines, they are allowed before first expression in list
 	p.eatNewLines()
@@ -621,18 +1113,51 @@ func (p *Parser) expressionList() []ast.Expression {
 	return exprs
 }
 
+// elementList parses the items of an array literal, any of which can be spread with `...`
+func (p *Parser) elementList() []ast.Expression {
+	p.eatNewLines()
+
+	exprs := []ast.Expression{}
+	for ok := true; ok; ok = p.match(token.COMMA) {
+		p.eatNewLines()
+		if p.match(token.DOT_DOT_DOT) {
+			exprs = append(exprs, &ast.SpreadExpression{Operator: p.previous(), Expr: p.expression()})
+		} else {
+			exprs = append(exprs, p.expression())
+		}
+		p.eatNewLines()
+	}
+	return exprs
+}
+
 func (p *Parser) finishIndex(array ast.Expression) ast.Expression {
-	leftIndex := p.expression()
-	var rightIndex ast.Expression
-	if p.match(token.COLON) {
-		rightIndex = p.expression()
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	// all parts of a slice are optional, e.g. `x[1:]`, `x[:-1]` and `x[::2]`
+	var leftIndex, rightIndex, step ast.Expression
+	if !p.check(token.COLON) {
+		leftIndex = p.expression()
+	}
+
+	slice := p.match(token.COLON)
+	if slice {
+		if !p.check(token.COLON) && !p.check(token.RIGHT_BRACKET) {
+			rightIndex = p.expression()
+		}
+		if p.match(token.COLON) && !p.check(token.RIGHT_BRACKET) {
+			step = p.expression()
+		}
 	}
 	closingBracket := p.consume(token.RIGHT_BRACKET, "Expect ']' after index")
 
-	return &ast.IndexExpression{Object: array, LeftIndex: leftIndex, RightIndex: rightIndex, ClosingBracket: closingBracket}
+	return &ast.IndexExpression{Object: array, LeftIndex: leftIndex, RightIndex: rightIndex, Step: step, Slice: slice, ClosingBracket: closingBracket}
 }
 
 func (p *Parser) finishCall(callee ast.Expression) ast.Expression {
+	p.nesting++
+	defer func() { p.nesting-- }()
+
 	args := []ast.Expression{}
 	if !p.check(token.RIGHT_PAREN) {
 		for ok := true; ok; ok = p.match(token.COMMA) {
@@ -696,12 +1221,54 @@ func (p *Parser) check(tokenType token.TokenType) bool {
 }
 
 func (p *Parser) checkAhead(tokenType token.TokenType, lookahead int) bool {
-	position := p.current + lookahead
+	position := p.skipNewLines(p.current)
+	for ; lookahead > 0 && position < len(p.tokens); lookahead-- {
+		position = p.skipNewLines(position + 1)
+	}
+	if position >= len(p.tokens) {
+		return false
+	}
 	return p.tokens[position].Type == tokenType
 }
 
+// skipNewLines returns the position of the first token from position that the parser
+// can see, which skips over newlines while inside brackets
+func (p *Parser) skipNewLines(position int) int {
+	for p.nesting > 0 && position < len(p.tokens) && p.tokens[position].Type == token.NEW_LINE {
+		position++
+	}
+	return position
+}
+
+// matchOnNextLine continues an expression onto the next line if it starts with the given token,
+// which is only done for tokens that can't start a statement, e.g. a leading '.'
+func (p *Parser) matchOnNextLine(tokenType token.TokenType) bool {
+	position := p.current
+	for position < len(p.tokens) && p.tokens[position].Type == token.NEW_LINE {
+		position++
+	}
+	if position == p.current || position >= len(p.tokens) || p.tokens[position].Type != tokenType {
+		return false
+	}
+
+	p.current = position
+	p.advance()
+	return true
+}
+
+// resetNesting makes newlines significant again, e.g. in a block inside brackets,
+// and returns a function that restores the nesting once the block is parsed
+func (p *Parser) resetNesting() func() {
+	nesting := p.nesting
+	p.nesting = 0
+	return func() {
+		p.nesting = nesting
+	}
+}
+
 func (p *Parser) advance() *token.Token {
 	if !p.isAtEnd() {
+		p.last = p.current
 		p.current++
 	}
 	return p.previous()
@@ -712,11 +1279,12 @@ func (p *Parser) isAtEnd() bool {
 }
 
 func (p *Parser) peek() *token.Token {
+	p.current = p.skipNewLines(p.current)
 	return &p.tokens[p.current]
 }
 
 func (p *Parser) previous() *token.Token {
-	return &p.tokens[p.current-1]
+	return &p.tokens[p.last]
 }
 
 func (p *Parser) synchronize() {
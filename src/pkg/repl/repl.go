@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/hutcho66/glox/src/pkg/checker"
 	"github.com/hutcho66/glox/src/pkg/interpreter"
 	"github.com/hutcho66/glox/src/pkg/lox_error"
 	"github.com/hutcho66/glox/src/pkg/parser"
@@ -12,9 +13,10 @@ import (
 	"github.com/hutcho66/glox/src/pkg/scanner"
 )
 
-func RunFile(content string) {
-	errors := &lox_error.LoxErrors{}
+func RunFile(content string, assertions bool) {
+	errors := lox_error.NewLoxErrors(lox_error.LoxReporter{})
 	ipr := interpreter.NewInterpreter(errors)
+	ipr.SetAssertions(assertions)
 	run(string(content), ipr, errors, false)
 
 	// If there was an error when parsing, exit before interpreting
@@ -26,11 +28,40 @@ func RunFile(content string) {
 	}
 }
 
-func RunPrompt() {
-	errors := &lox_error.LoxErrors{}
+// CheckFile type checks a script without running it
+func CheckFile(content string) {
+	errors := lox_error.NewLoxErrors(lox_error.LoxReporter{})
+
+	s := scanner.NewScanner(content, errors)
+	toks := s.ScanTokens()
+	if errors.HadScanningError() {
+		os.Exit(65)
+	}
+
+	p := parser.NewParser(toks, errors)
+	statements := p.Parse()
+	if errors.HadParsingError() {
+		os.Exit(65)
+	}
+
+	r := resolver.NewResolver(interpreter.NewInterpreter(errors), errors)
+	r.Resolve(statements)
+	if errors.HadResolutionError() {
+		os.Exit(65)
+	}
+
+	c := checker.NewChecker(errors)
+	if !c.Check(statements) {
+		os.Exit(65)
+	}
+}
+
+func RunPrompt(assertions bool) {
+	errors := lox_error.NewLoxErrors(lox_error.LoxReporter{})
 
 	reader := bufio.NewReader(os.Stdin)
 	ipr := interpreter.NewInterpreter(errors)
+	ipr.SetAssertions(assertions)
 	fmt.Println("Welcome to the glox repl. Press CTRL-Z to exit.")
 
 	for {
@@ -73,6 +104,8 @@ func run(source string, ipr *interpreter.Interpreter, errors *lox_error.LoxError
 	}
 
 	if prompt && ok {
-		fmt.Println(interpreter.Representation(last_expression_value))
+		if representation, ok := ipr.Stringify(last_expression_value); ok {
+			fmt.Println(representation)
+		}
 	}
 }
@@ -1,8 +1,9 @@
 package resolver
 
 import (
+	"slices"
+
 	"github.com/hutcho66/glox/src/pkg/ast"
-	"github.com/hutcho66/glox/src/pkg/interpreter"
 	"github.com/hutcho66/glox/src/pkg/lox_error"
 	"github.com/hutcho66/glox/src/pkg/token"
 )
@@ -23,17 +24,24 @@ const (
 	SUBCLASS
 )
 
+// Interpreter is told how many scopes out the variable used by each expression is declared.
+// The interpreter package implements it, and uses the resolver itself to eval source.
+type Interpreter interface {
+	Resolve(expression ast.Expression, depth int)
+}
+
 type Resolver struct {
 	errors          *lox_error.LoxErrors
-	interpreter     *interpreter.Interpreter
+	interpreter     Interpreter
 	scopes          []map[string]bool
 	currentFunction FunctionType
 	currentClass    ClassType
 	currentMethod   ast.MethodType
 	loop            bool
+	labels          []string
 }
 
-func NewResolver(interpreter *interpreter.Interpreter, errors *lox_error.LoxErrors) *Resolver {
+func NewResolver(interpreter Interpreter, errors *lox_error.LoxErrors) *Resolver {
 	return &Resolver{
 		errors:          errors,
 		interpreter:     interpreter,
@@ -42,6 +50,7 @@ func NewResolver(interpreter *interpreter.Interpreter, errors *lox_error.LoxErro
 		currentClass:    NOT_CLASS,
 		currentMethod:   ast.NOT_METHOD,
 		loop:            false,
+		labels:          []string{},
 	}
 }
 
@@ -58,6 +67,26 @@ func (r *Resolver) Resolve(statements []ast.Statement) (ok bool) {
 	return true
 }
 
+// ResolveScope resolves statements in a scope that already has the given names declared,
+// as when source is evaluated with variables passed to it
+func (r *Resolver) ResolveScope(statements []ast.Statement, names []string) (ok bool) {
+	defer func() {
+		// catch any errors
+		if err := recover(); err != nil {
+			ok = false
+			return
+		}
+	}()
+
+	r.beginScope()
+	for _, name := range names {
+		r.peekScope()[name] = true
+	}
+	r.resolveStatements(statements)
+	r.endScope()
+	return true
+}
+
 func (r *Resolver) resolveStatements(statements []ast.Statement) {
 	for _, s := range statements {
 		r.resolveStatement(s)
@@ -91,15 +120,62 @@ func (r *Resolver) resolveFunction(function *ast.FunctionStatement, functionType
 	enclosingFunction := r.currentFunction
 	r.currentFunction = functionType
 
+	// loops and labels don't extend into function bodies
+	enclosingLoop, enclosingLabels := r.loop, r.labels
+	r.loop, r.labels = false, []string{}
+
 	r.beginScope()
 	for _, param := range function.Params {
 		r.declare(param)
 		r.define(param)
 	}
+
+	for _, condition := range function.Requires {
+		r.resolveStatement(condition)
+	}
+	if len(function.Ensures) > 0 {
+		// ensures clauses can refer to the return value as result, which is in its own scope
+		r.beginScope()
+		result := &token.Token{Type: token.IDENTIFIER, Lexeme: "result", Line: function.Ensures[0].Keyword.Line}
+		r.declare(result)
+		r.define(result)
+		for _, condition := range function.Ensures {
+			r.resolveStatement(condition)
+		}
+		r.endScope()
+	}
+
 	r.resolveStatements(function.Body)
 	r.endScope()
 
 	r.currentFunction = enclosingFunction
+	r.loop, r.labels = enclosingLoop, enclosingLabels
+}
+
+func (r *Resolver) beginLoop(label *token.Token) (enclosingLoop bool) {
+	if label != nil {
+		if slices.Contains(r.labels, label.Lexeme) {
+			panic(r.errors.ResolutionError(label, "Label '"+label.Lexeme+"' is already in use by an enclosing loop"))
+		}
+		r.labels = append(r.labels, label.Lexeme)
+	}
+
+	enclosingLoop = r.loop
+	r.loop = true
+	return enclosingLoop
+}
+
+func (r *Resolver) endLoop(label *token.Token, enclosingLoop bool) {
+	if label != nil {
+		r.labels = r.labels[:len(r.labels)-1]
+	}
+	r.loop = enclosingLoop
+}
+
+func (r *Resolver) resolveLabel(label *token.Token) {
+	if label != nil && !slices.Contains(r.labels, label.Lexeme) {
+		panic(r.errors.ResolutionError(label, "Undefined label '"+label.Lexeme+"'"))
+	}
 }
 
 func (r *Resolver) beginScope() {
@@ -148,7 +224,15 @@ func (r *Resolver) VisitExpressionStatement(e *ast.ExpressionStatement) {
 	r.resolveExpression(e.Expr)
 }
 
+func (r *Resolver) resolveDecorators(decorators []ast.Expression) {
+	for _, decorator := range decorators {
+		r.resolveExpression(decorator)
+	}
+}
+
 func (r *Resolver) VisitFunctionStatement(s *ast.FunctionStatement) {
+	r.resolveDecorators(s.Decorators)
+
 	r.declare(s.Name)
 	r.define(s.Name)
 
@@ -156,17 +240,29 @@ func (r *Resolver) VisitFunctionStatement(s *ast.FunctionStatement) {
 }
 
 func (r *Resolver) VisitClassStatement(s *ast.ClassStatement) {
-	enclosingClass := r.currentClass
-	r.currentClass = CLASS
+	// decorators are evaluated in the enclosing scope, before the class is defined
+	r.resolveDecorators(s.Decorators)
+	for _, method := range s.Methods {
+		r.resolveDecorators(method.Decorators)
+	}
 
 	r.declare(s.Name)
 	r.define(s.Name)
 
-	if s.Superclass != nil {
-		if s.Name.Lexeme == s.Superclass.Name.Lexeme {
-			panic(r.errors.ResolutionError(s.Superclass.Name, "A class can't inherit from itself."))
-		}
+	if s.Superclass != nil && s.Name.Lexeme == s.Superclass.Name.Lexeme {
+		panic(r.errors.ResolutionError(s.Superclass.Name, "A class can't inherit from itself."))
+	}
+
+	r.resolveClass(s)
+}
 
+// resolveClass resolves the superclass and methods of a class, which may be declared
+// by a statement or be the class of an anonymous class or object literal
+func (r *Resolver) resolveClass(s *ast.ClassStatement) {
+	enclosingClass := r.currentClass
+	r.currentClass = CLASS
+
+	if s.Superclass != nil {
 		r.currentClass = SUBCLASS
 		r.resolveExpression(s.Superclass)
 	}
@@ -179,8 +275,18 @@ func (r *Resolver) VisitClassStatement(s *ast.ClassStatement) {
 	r.beginScope()
 
 	r.peekScope()["this"] = true
+	if s.Record {
+		names := make([]*token.Token, len(s.Fields))
+		for i, field := range s.Fields {
+			names[i] = field.Name
+		}
+		r.resolveFieldNames(names, "Record")
+	}
 	for _, method := range s.Methods {
 		if method.Name.Lexeme == "init" {
+			if s.Record {
+				panic(r.errors.ResolutionError(method.Name, "Records can't define an init method"))
+			}
 			if method.Kind != ast.NORMAL_METHOD {
 				panic(r.errors.ResolutionError(s.Name, "init method cannot be static, getter or setter"))
 			}
@@ -201,6 +307,17 @@ func (r *Resolver) VisitClassStatement(s *ast.ClassStatement) {
 	r.currentClass = enclosingClass
 }
 
+// resolveFieldNames checks that each field of a record or object literal is only declared once
+func (r *Resolver) resolveFieldNames(names []*token.Token, kind string) {
+	declared := map[string]bool{}
+	for _, name := range names {
+		if declared[name.Lexeme] {
+			panic(r.errors.ResolutionError(name, kind+" already has a field named '"+name.Lexeme+"'"))
+		}
+		declared[name.Lexeme] = true
+	}
+}
+
 func (r *Resolver) VisitIfStatement(s *ast.IfStatement) {
 	r.resolveExpression(s.Condition)
 	r.resolveStatement(s.Consequence)
@@ -221,6 +338,21 @@ func (r *Resolver) VisitReturnStatement(s *ast.ReturnStatement) {
 			panic(r.errors.ResolutionError(s.Keyword, "Can't return a value from a setter"))
 		}
 		r.resolveExpression(s.Value)
+
+		// nothing is left to do in this function once the call returns, so
+		// the interpreter can run it in place of the current call
+		_, s.TailCall = s.Value.(*ast.CallExpression)
+	}
+}
+
+func (r *Resolver) VisitDeferStatement(s *ast.DeferStatement) {
+	r.resolveExpression(s.Call)
+}
+
+func (r *Resolver) VisitAssertStatement(s *ast.AssertStatement) {
+	r.resolveExpression(s.Condition)
+	if s.Message != nil {
+		r.resolveExpression(s.Message)
 	}
 }
 
@@ -228,12 +360,14 @@ func (r *Resolver) VisitBreakStatement(s *ast.BreakStatement) {
 	if r.loop == false {
 		panic(r.errors.ResolutionError(s.Keyword, "Can't break when not in loop"))
 	}
+	r.resolveLabel(s.Label)
 }
 
 func (r *Resolver) VisitContinueStatement(s *ast.ContinueStatement) {
 	if r.loop == false {
 		panic(r.errors.ResolutionError(s.Keyword, "Can't continue when not in loop"))
 	}
+	r.resolveLabel(s.Label)
 }
 
 func (r *Resolver) VisitVarStatement(s *ast.VarStatement) {
@@ -247,12 +381,12 @@ func (r *Resolver) VisitVarStatement(s *ast.VarStatement) {
 func (r *Resolver) VisitLoopStatement(s *ast.LoopStatement) {
 	r.resolveExpression(s.Condition)
 
-	r.loop = true
+	enclosingLoop := r.beginLoop(s.Label)
 	r.resolveStatement(s.Body)
 	if s.Increment != nil {
 		r.resolveExpression(s.Increment)
 	}
-	r.loop = false
+	r.endLoop(s.Label, enclosingLoop)
 }
 
 func (r *Resolver) VisitForEachStatement(s *ast.ForEachStatement) {
@@ -263,9 +397,9 @@ func (r *Resolver) VisitForEachStatement(s *ast.ForEachStatement) {
 	r.declare(s.VariableName)
 	r.define(s.VariableName)
 
-	r.loop = true
+	enclosingLoop := r.beginLoop(s.Label)
 	r.resolveStatement(s.Body)
-	r.loop = false
+	r.endLoop(s.Label, enclosingLoop)
 
 	r.endScope()
 }
@@ -290,6 +424,17 @@ func (r *Resolver) VisitBinaryExpression(e *ast.BinaryExpression) any {
 	return nil
 }
 
+func (r *Resolver) VisitPipelineExpression(e *ast.PipelineExpression) any {
+	r.resolveExpression(e.Left)
+	r.resolveExpression(e.Callee)
+	for _, arg := range e.Arguments {
+		if arg != nil {
+			r.resolveExpression(arg)
+		}
+	}
+	return nil
+}
+
 func (r *Resolver) VisitCallExpression(e *ast.CallExpression) any {
 	r.resolveExpression(e.Callee)
 	for _, arg := range e.Arguments {
@@ -300,10 +445,24 @@ func (r *Resolver) VisitCallExpression(e *ast.CallExpression) any {
 
 func (r *Resolver) VisitIndexExpression(e *ast.IndexExpression) any {
 	r.resolveExpression(e.Object)
-	r.resolveExpression(e.LeftIndex)
+	if e.LeftIndex != nil {
+		r.resolveExpression(e.LeftIndex)
+	}
 	if e.RightIndex != nil {
 		r.resolveExpression(e.RightIndex)
 	}
+	if e.Step != nil {
+		r.resolveExpression(e.Step)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitRangeExpression(e *ast.RangeExpression) any {
+	r.resolveExpression(e.Start)
+	r.resolveExpression(e.End)
+	if e.Step != nil {
+		r.resolveExpression(e.Step)
+	}
 	return nil
 }
 
@@ -357,7 +516,41 @@ func (r *Resolver) VisitArrayExpression(e *ast.ArrayExpression) any {
 func (r *Resolver) VisitMapExpression(e *ast.MapExpression) any {
 	for i := range e.Keys {
 		r.resolveExpression(e.Keys[i])
-		r.resolveExpression(e.Values[i])
+		if e.Values[i] != nil {
+			r.resolveExpression(e.Values[i])
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) VisitSpreadExpression(e *ast.SpreadExpression) any {
+	r.resolveExpression(e.Expr)
+	return nil
+}
+
+func (r *Resolver) VisitComprehensionExpression(e *ast.ComprehensionExpression) any {
+	// like for-of loops, each for clause gets a new scope containing its variable
+	scopes := 0
+	for _, clause := range e.Clauses {
+		if clause.Variable == nil {
+			r.resolveExpression(clause.Condition)
+			continue
+		}
+
+		r.resolveExpression(clause.Iterable)
+		r.beginScope()
+		r.declare(clause.Variable)
+		r.define(clause.Variable)
+		scopes++
+	}
+
+	if e.Key != nil {
+		r.resolveExpression(e.Key)
+	}
+	r.resolveExpression(e.Value)
+
+	for ; scopes > 0; scopes-- {
+		r.endScope()
 	}
 	return nil
 }
@@ -385,6 +578,31 @@ func (r *Resolver) VisitLambdaExpression(e *ast.LambdaExpression) any {
 	return nil
 }
 
+func (r *Resolver) VisitClassExpression(e *ast.ClassExpression) any {
+	for _, method := range e.Class.Methods {
+		r.resolveDecorators(method.Decorators)
+	}
+	r.resolveClass(e.Class)
+	return nil
+}
+
+func (r *Resolver) VisitObjectExpression(e *ast.ObjectExpression) any {
+	r.resolveFieldNames(e.Fields, "Object")
+
+	// field values are evaluated before the object exists, so can't refer to this
+	for _, value := range e.Values {
+		r.resolveExpression(value)
+	}
+	for _, method := range e.Class.Methods {
+		if method.Name.Lexeme == "init" {
+			panic(r.errors.ResolutionError(method.Name, "Object literals can't define an init method"))
+		}
+		r.resolveDecorators(method.Decorators)
+	}
+	r.resolveClass(e.Class)
+	return nil
+}
+
 func (r *Resolver) VisitLiteralExpression(e *ast.LiteralExpression) any {
 	return nil
 }
@@ -1,17 +1,28 @@
 package scanner
 
 import (
+	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/hutcho66/glox/src/pkg/lox_error"
 	"github.com/hutcho66/glox/src/pkg/token"
 )
 
+// numberConstants are names that are scanned as number literals
+var numberConstants = map[string]float64{
+	"Infinity": math.Inf(1),
+	"NaN":      math.NaN(),
+}
+
 type Scanner struct {
 	errors               *lox_error.LoxErrors
 	source               string
 	tokens               []token.Token
 	start, current, line int
+	doc                  []string
 }
 
 // Public methods
@@ -24,6 +35,7 @@ func NewScanner(source string, errors *lox_error.LoxErrors) *Scanner {
 		start:   0,
 		current: 0,
 		line:    1,
+		doc:     []string{},
 	}
 }
 
@@ -58,7 +70,15 @@ func (s *Scanner) scanToken() {
 	case ',':
 		s.addToken(token.COMMA)
 	case '.':
-		s.addToken(token.DOT)
+		if s.match('.') {
+			if s.match('.') {
+				s.addToken(token.DOT_DOT_DOT)
+			} else {
+				s.addTokenConditional('<', token.DOT_DOT_LESS, token.DOT_DOT)
+			}
+		} else {
+			s.addToken(token.DOT)
+		}
 	case '-':
 		s.addToken(token.MINUS)
 	case '+':
@@ -71,6 +91,8 @@ func (s *Scanner) scanToken() {
 		s.addToken(token.QUESTION)
 	case ':':
 		s.addToken(token.COLON)
+	case '@':
+		s.addToken(token.AT)
 	case '!':
 		s.addTokenConditional('=', token.BANG_EQUAL, token.BANG)
 	case '=':
@@ -83,6 +105,12 @@ func (s *Scanner) scanToken() {
 				s.addToken(token.EQUAL)
 			}
 		}
+	case '|':
+		if s.match('>') {
+			s.addToken(token.PIPELINE)
+		} else {
+			s.errors.ScannerError(s.line, "Unexpected character.")
+		}
 	case '<':
 		s.addTokenConditional('=', token.LESS_EQUAL, token.LESS)
 	case '>':
@@ -90,10 +118,9 @@ func (s *Scanner) scanToken() {
 	case '/':
 		{
 			if s.match('/') {
-				// Comment goes to the end of the line
-				for s.peek() != '\n' && !s.isAtEnd() {
-					s.advance()
-				}
+				s.lineComment()
+			} else if s.match('*') {
+				s.blockComment()
 			} else {
 				s.addToken(token.SLASH)
 			}
@@ -131,6 +158,48 @@ func (s *Scanner) scanToken() {
 	}
 }
 
+func (s *Scanner) lineComment() {
+	// a comment starting with exactly three slashes at the start of a line is a doc comment
+	isDoc := s.peek() == '/' && s.peekNext() != '/' && s.isAtLineStart()
+
+	// Comment goes to the end of the line
+	for s.peek() != '\n' && !s.isAtEnd() {
+		s.advance()
+	}
+
+	if isDoc {
+		// trim the slashes and a single leading space
+		text := strings.TrimPrefix(s.source[s.start+3:s.current], " ")
+		s.doc = append(s.doc, strings.TrimRight(text, "\r"))
+	}
+}
+
+func (s *Scanner) blockComment() {
+	// block comments can be nested, so track how deep we are
+	depth := 1
+	for depth > 0 {
+		if s.isAtEnd() {
+			s.errors.ScannerError(s.line, "Unterminated block comment.")
+			return
+		}
+
+		if s.peek() == '/' && s.peekNext() == '*' {
+			s.advance()
+			depth++
+		} else if s.peek() == '*' && s.peekNext() == '/' {
+			s.advance()
+			depth--
+		} else if s.peek() == '\n' {
+			s.line++
+		}
+		s.advance()
+	}
+}
+
+func (s *Scanner) isAtLineStart() bool {
+	return len(s.tokens) == 0 || s.tokens[len(s.tokens)-1].Type == token.NEW_LINE
+}
+
 func (s *Scanner) string() {
 	// Advance until either EOF or closing quote, incrementing line count when necessary
 	for s.peek() != '"' && !s.isAtEnd() {
@@ -154,33 +223,96 @@ func (s *Scanner) string() {
 }
 
 func (s *Scanner) number() {
-	for isDigit(s.peek()) {
-		s.advance()
+	if s.source[s.start] == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			s.radixNumber(16, "hexadecimal")
+			return
+		case 'o', 'O':
+			s.radixNumber(8, "octal")
+			return
+		case 'b', 'B':
+			s.radixNumber(2, "binary")
+			return
+		}
 	}
 
-	if s.peek() == '.' {
+	if !s.digits(10) {
+		return
+	}
+
+	// a second dot is a range operator and a name is a method, not a decimal point
+	if s.peek() == '.' && s.peekNext() != '.' && !isAlpha(s.peekNext()) {
 		s.advance()
 
-		if s.isAtEnd() {
-			s.errors.ScannerError(s.line, "Unterminated number literal.")
+		if isDigit(s.peek()) && !s.digits(10) {
 			return
 		}
+	}
 
-		for isDigit(s.peek()) {
+	// without digits, an e is the start of a name rather than an exponent
+	if s.peek() == 'e' || s.peek() == 'E' {
+		if isDigit(s.peekNext()) || ((s.peekNext() == '+' || s.peekNext() == '-') && isDigit(s.peekAt(2))) {
 			s.advance()
+			if !s.match('+') {
+				s.match('-')
+			}
+			if !s.digits(10) {
+				return
+			}
 		}
 	}
 
-	value, _ := strconv.ParseFloat(s.source[s.start:s.current], 64)
+	value, _ := strconv.ParseFloat(strings.ReplaceAll(s.source[s.start:s.current], "_", ""), 64)
+	s.addTokenWithLiteral(token.NUMBER, value)
+}
+
+// radixNumber scans an integer literal in another base, after its leading 0
+func (s *Scanner) radixNumber(base int, name string) {
+	// consume the base prefix
+	s.advance()
+	start := s.current
+
+	if digitValue(s.peek()) >= base {
+		s.errors.ScannerError(s.line, "Expect digits in "+name+" literal.")
+		return
+	}
+	if !s.digits(base) {
+		return
+	}
+	if isAlphaNumeric(s.peek()) {
+		s.errors.ScannerError(s.line, fmt.Sprintf("Invalid digit '%c' in %s literal.", s.peek(), name))
+		return
+	}
+
+	// literals too large for an integer are still valid numbers
+	integer, _ := new(big.Int).SetString(strings.ReplaceAll(s.source[start:s.current], "_", ""), base)
+	value, _ := new(big.Float).SetInt(integer).Float64()
 	s.addTokenWithLiteral(token.NUMBER, value)
 }
 
+// digits consumes a run of digits in the given base, which may be separated by single
+// underscores. It reports an error and returns false if a separator isn't between two digits.
+func (s *Scanner) digits(base int) bool {
+	for digitValue(s.peek()) < base || s.peek() == '_' {
+		if s.advance() == '_' && digitValue(s.peek()) >= base {
+			s.errors.ScannerError(s.line, "Digit separator must be between two digits.")
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Scanner) identifier() {
 	for isAlphaNumeric(s.peek()) {
 		s.advance()
 	}
 
 	word := s.source[s.start:s.current]
+	if value, ok := numberConstants[word]; ok {
+		s.addTokenWithLiteral(token.NUMBER, value)
+		return
+	}
 	s.addToken(token.LookupKeyword(word))
 }
 
@@ -204,6 +336,17 @@ func (s *Scanner) peek() byte {
 	return s.source[s.current]
 }
 
+func (s *Scanner) peekNext() byte {
+	return s.peekAt(1)
+}
+
+func (s *Scanner) peekAt(offset int) byte {
+	if s.current+offset >= len(s.source) {
+		return '\x00'
+	}
+	return s.source[s.current+offset]
+}
+
 func (s *Scanner) advance() byte {
 	ch := s.source[s.current]
 	s.current++
@@ -224,7 +367,30 @@ func (s *Scanner) addTokenConditional(expected byte, matchType, elseType token.T
 
 func (s *Scanner) addTokenWithLiteral(tokenType token.TokenType, literal any) {
 	lexeme := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, token.Token{Type: tokenType, Lexeme: lexeme, Literal: literal, Line: s.line})
+
+	// any pending doc comment is attached to the next real token
+	doc := ""
+	if tokenType != token.NEW_LINE && len(s.doc) > 0 {
+		doc = strings.Join(s.doc, "\n")
+		s.doc = []string{}
+	}
+
+	spaced := s.start > 0 && strings.ContainsRune(" \t\r\n", rune(s.source[s.start-1]))
+
+	s.tokens = append(s.tokens, token.Token{Type: tokenType, Lexeme: lexeme, Literal: literal, Line: s.line, Doc: doc, Spaced: spaced})
+}
+
+// digitValue is the value of a digit in bases up to 16, or 16 if the character isn't a digit
+func digitValue(ch byte) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return 16
 }
 
 func isDigit(ch byte) bool {
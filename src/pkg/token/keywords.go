@@ -2,18 +2,22 @@ package token
 
 var keywords = map[string]TokenType{
 	"and":      AND,
+	"assert":   ASSERT,
 	"break":    BREAK,
 	"class":    CLASS,
 	"continue": CONTINUE,
+	"defer":    DEFER,
 	"else":     ELSE,
 	"false":    FALSE,
 	"for":      FOR,
 	"fun":      FUN,
 	"get":      GET,
 	"if":       IF,
+	"in":       IN,
 	"nil":      NIL,
 	"of":       OF,
 	"or":       OR,
+	"record":   RECORD,
 	"return":   RETURN,
 	"set":      SET,
 	"static":   STATIC,
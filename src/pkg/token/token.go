@@ -5,4 +5,8 @@ type Token struct {
 	Lexeme  string
 	Literal any
 	Line    int
+	Doc     string
+
+	// Spaced is whether the token follows whitespace, so that source text can be rebuilt from tokens
+	Spaced bool
 }
@@ -23,6 +23,7 @@ const (
 	STAR          = "*"
 	QUESTION      = "?"
 	COLON         = ":"
+	AT            = "@"
 
 	// Multi character symbols
 	BANG          = "!"
@@ -34,6 +35,11 @@ const (
 	LESS          = "<"
 	LESS_EQUAL    = "<="
 	LAMBDA_ARROW  = "=>"
+	PIPELINE      = "|>"
+	DOT_DOT       = ".."
+	DOT_DOT_LESS  = "..<"
+	DOT_DOT_DOT   = "..."
+	NOT_IN        = "NOT_IN"
 
 	// Literals
 	IDENTIFIER = "IDENTIFIER"
@@ -42,18 +48,22 @@ const (
 
 	// Keywords
 	AND      = "AND"
+	ASSERT   = "ASSERT"
 	BREAK    = "BREAK"
 	CLASS    = "CLASS"
 	CONTINUE = "CONTINUE"
+	DEFER    = "DEFER"
 	ELSE     = "ELSE"
 	FALSE    = "FALSE"
 	FUN      = "FUN"
 	FOR      = "FOR"
 	GET      = "GET"
 	IF       = "IF"
+	IN       = "IN"
 	NIL      = "NIL"
 	OF       = "OF"
 	OR       = "OR"
+	RECORD   = "RECORD"
 	RETURN   = "RETURN"
 	SET      = "SET"
 	STATIC   = "STATIC"